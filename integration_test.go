@@ -0,0 +1,1571 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wtBinary is the path of the wt binary built once for the integration tests
+var wtBinary string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	if _, err := exec.LookPath("git"); err != nil {
+		fmt.Println("git not found, skipping integration tests")
+		return m.Run()
+	}
+
+	dir, err := os.MkdirTemp("", "wt-bin-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	wtBinary = filepath.Join(dir, "wt")
+	build := exec.Command("go", "build", "-o", wtBinary, ".")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to build wt:", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// fakeShell stands in for $SHELL. `-i -c cmd` runs cmd like the agent
+// launcher expects; a bare invocation records where the shell was opened.
+const fakeShell = `#!/bin/sh
+if [ "$1" = "-i" ] && [ "$2" = "-c" ]; then
+	exec /bin/sh -c "$3"
+fi
+echo "shell dir=$(pwd) session=$WT_SESSION" >> "$WT_TEST_LOG"
+`
+
+// fakeAgent stands in for the claude binary and records each launch. It
+// takes WT_TEST_AGENT_SLEEP seconds to finish, if set.
+const fakeAgent = `#!/bin/sh
+echo "agent dir=$(pwd) args=$*" >> "$WT_TEST_LOG"
+echo "agent working"
+[ -n "$WT_TEST_AGENT_SLEEP" ] && sleep "$WT_TEST_AGENT_SLEEP"
+echo "agent done"
+`
+
+// testEnv is an isolated HOME with a repository cloned from a local bare origin
+type testEnv struct {
+	t      *testing.T
+	home   string
+	origin string
+	repo   string
+	log    string
+	env    []string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	if wtBinary == "" {
+		t.Skip("git not available")
+	}
+
+	// Resolve symlinks so paths match what git reports (e.g. /var on macOS)
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &testEnv{
+		t:      t,
+		home:   filepath.Join(root, "home"),
+		origin: filepath.Join(root, "origin.git"),
+		repo:   filepath.Join(root, "myrepo"),
+		log:    filepath.Join(root, "launches.log"),
+	}
+
+	bin := filepath.Join(root, "bin")
+	for _, dir := range []string{e.home, bin} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript(t, filepath.Join(bin, "claude"), fakeAgent)
+	writeScript(t, filepath.Join(bin, "fakeshell"), fakeShell)
+
+	e.env = append(os.Environ(),
+		"HOME="+e.home,
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"SHELL="+filepath.Join(bin, "fakeshell"),
+		"WT_TEST_LOG="+e.log,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=wt test",
+		"GIT_AUTHOR_EMAIL=wt@example.com",
+		"GIT_COMMITTER_NAME=wt test",
+		"GIT_COMMITTER_EMAIL=wt@example.com",
+	)
+
+	e.git(root, "init", "--bare", "-b", "main", e.origin)
+	e.git(root, "init", "-b", "main", e.repo)
+	e.git(e.repo, "remote", "add", "origin", e.origin)
+	e.commit(e.repo, "README.md", "initial")
+	e.git(e.repo, "push", "-u", "origin", "main")
+
+	return e
+}
+
+func writeScript(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// git runs git in dir and fails the test on error
+func (e *testEnv) git(dir string, args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = e.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		e.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes file in dir and commits it with msg as subject and content
+func (e *testEnv) commit(dir, file, msg string) {
+	e.t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(msg+"\n"), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+	e.git(dir, "add", file)
+	e.git(dir, "commit", "-m", msg)
+}
+
+// wt runs the wt binary in the repository and returns its combined output
+// and exit code
+func (e *testEnv) wt(args ...string) (string, int) {
+	e.t.Helper()
+	cmd := exec.Command(wtBinary, args...)
+	cmd.Dir = e.repo
+	cmd.Env = e.env
+	cmd.Stdin = strings.NewReader("")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		e.t.Fatalf("wt %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String(), 0
+}
+
+// mustWt runs wt and fails the test if it exits non-zero
+func (e *testEnv) mustWt(args ...string) string {
+	e.t.Helper()
+	out, code := e.wt(args...)
+	if code != 0 {
+		e.t.Fatalf("wt %s exited %d:\n%s", strings.Join(args, " "), code, out)
+	}
+	return out
+}
+
+// launches returns the lines recorded by the fake agent and shell
+func (e *testEnv) launches() []string {
+	e.t.Helper()
+	data, err := os.ReadFile(e.log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (e *testEnv) sessionPath(name string) string {
+	return filepath.Join(e.home, ".wt", "myrepo-"+name)
+}
+
+func (e *testEnv) branchExists(branch string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	cmd.Dir = e.repo
+	cmd.Env = e.env
+	return cmd.Run() == nil
+}
+
+func TestIntegrationNew(t *testing.T) {
+	e := newTestEnv(t)
+
+	out := e.mustWt("new", "feature")
+	if !strings.Contains(out, "Session 'feature' created successfully!") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	path := e.sessionPath("feature")
+	if _, err := os.Stat(filepath.Join(path, "README.md")); err != nil {
+		t.Errorf("worktree not checked out: %v", err)
+	}
+	if got := e.git(path, "rev-parse", "--abbrev-ref", "HEAD"); got != "wt-feature" {
+		t.Errorf("worktree branch = %q, want wt-feature", got)
+	}
+
+	launches := e.launches()
+	want := fmt.Sprintf("agent dir=%s args=--add-dir %s", path, e.repo)
+	if len(launches) != 1 || launches[0] != want {
+		t.Errorf("launches = %q, want %q", launches, want)
+	}
+}
+
+func TestIntegrationNewPicksUpOriginCommits(t *testing.T) {
+	e := newTestEnv(t)
+
+	e.pushUpstreamCommit()
+
+	e.mustWt("new", "feature")
+	if !e.hasUpstreamCommit("feature") {
+		t.Error("session should include origin's latest commit")
+	}
+}
+
+func TestIntegrationNewFromBranch(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "checkout", "-b", "develop")
+	e.commit(e.repo, "develop.txt", "develop work")
+	e.git(e.repo, "checkout", "main")
+
+	e.mustWt("new", "hotfix", "-b", "develop")
+	if _, err := os.Stat(filepath.Join(e.sessionPath("hotfix"), "develop.txt")); err != nil {
+		t.Errorf("session should be created from develop: %v", err)
+	}
+}
+
+func TestIntegrationNewFetchFailure(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "remote", "set-url", "origin", filepath.Join(e.home, "missing.git"))
+
+	out := e.mustWt("new", "offline")
+	if !strings.Contains(out, "Warning:") {
+		t.Errorf("expected a fetch warning:\n%s", out)
+	}
+	if _, err := os.Stat(e.sessionPath("offline")); err != nil {
+		t.Errorf("session should be created despite fetch failure: %v", err)
+	}
+}
+
+func TestIntegrationNewExistingBranch(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "branch", "wt-reuse")
+	e.git(e.repo, "checkout", "wt-reuse")
+	e.commit(e.repo, "reuse.txt", "existing work")
+	e.git(e.repo, "checkout", "main")
+
+	out := e.mustWt("new", "reuse")
+	if !strings.Contains(out, "already exists, using existing branch") {
+		t.Errorf("expected branch reuse message:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(e.sessionPath("reuse"), "reuse.txt")); err != nil {
+		t.Errorf("session should check out the existing branch: %v", err)
+	}
+}
+
+func TestIntegrationNewNameCollision(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "dup")
+
+	out, code := e.wt("new", "dup")
+	if code != exitAlreadyExists {
+		t.Fatalf("second wt new dup exited %d, want %d:\n%s", code, exitAlreadyExists, out)
+	}
+	if !strings.Contains(out, "already exists") {
+		t.Errorf("expected collision error:\n%s", out)
+	}
+	if len(e.launches()) != 1 {
+		t.Errorf("agent should only be launched once, got %q", e.launches())
+	}
+}
+
+func TestIntegrationFg(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feature")
+
+	e.mustWt("fg", "feat")
+	launches := e.launches()
+	want := fmt.Sprintf("agent dir=%s args=--continue", e.sessionPath("feature"))
+	if len(launches) != 2 || launches[1] != want {
+		t.Errorf("launches = %q, want last %q", launches, want)
+	}
+}
+
+func TestIntegrationFgNotFound(t *testing.T) {
+	e := newTestEnv(t)
+
+	out, code := e.wt("fg", "missing")
+	if code != exitNotFound || !strings.Contains(out, "not found") {
+		t.Errorf("wt fg missing = %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationLs(t *testing.T) {
+	e := newTestEnv(t)
+
+	if out := e.mustWt("ls"); !strings.Contains(out, "No active sessions") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	e.mustWt("new", "one")
+	e.mustWt("new", "two")
+	out := e.mustWt("ls")
+	for _, want := range []string{"one", "wt-one", "two", "wt-two", "~/.wt/myrepo-one"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ls output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestIntegrationCd(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feature")
+
+	e.mustWt("cd", "feature")
+	launches := e.launches()
+	want := fmt.Sprintf("shell dir=%s session=feature", e.sessionPath("feature"))
+	if launches[len(launches)-1] != want {
+		t.Errorf("launches = %q, want last %q", launches, want)
+	}
+}
+
+func TestIntegrationRm(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feature")
+
+	e.mustWt("rm", "feature")
+	if _, err := os.Stat(e.sessionPath("feature")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("worktree should be removed: %v", err)
+	}
+	if e.branchExists("wt-feature") {
+		t.Error("branch wt-feature should be deleted")
+	}
+}
+
+func TestIntegrationRmDirty(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feature")
+	if err := os.WriteFile(filepath.Join(e.sessionPath("feature"), "wip.txt"), []byte("wip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e.mustWt("rm", "feature")
+	if _, err := os.Stat(e.sessionPath("feature")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rm should remove a dirty worktree: %v", err)
+	}
+}
+
+func TestIntegrationUsageErrors(t *testing.T) {
+	e := newTestEnv(t)
+
+	for _, args := range [][]string{{}, {"bogus"}, {"fg"}, {"rm"}} {
+		if _, code := e.wt(args...); code != exitUsage {
+			t.Errorf("wt %v exited %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestIntegrationRmAmbiguous(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "auth-login")
+	e.mustWt("new", "auth-logout")
+
+	out, code := e.wt("rm", "auth")
+	if code != exitAmbiguous || !strings.Contains(out, "matches multiple sessions") {
+		t.Errorf("wt rm auth = %d:\n%s", code, out)
+	}
+	for _, name := range []string{"auth-login", "auth-logout"} {
+		if _, err := os.Stat(e.sessionPath(name)); err != nil {
+			t.Errorf("session %s should survive: %v", name, err)
+		}
+	}
+}
+
+func TestIntegrationRmLooseMatch(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feature", "-p", "Fix the login bug")
+
+	out, code := e.wt("rm", "login")
+	if code != exitNotFound || !strings.Contains(out, "only loosely matches session 'feature'") {
+		t.Errorf("wt rm login = %d:\n%s", code, out)
+	}
+	if _, err := os.Stat(e.sessionPath("feature")); err != nil {
+		t.Errorf("session matched only by its prompt should survive: %v", err)
+	}
+	e.mustWt("rm", "feat")
+}
+
+func TestIntegrationRmAll(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "one")
+	e.mustWt("new", "two")
+
+	e.mustWt("rm", "--all")
+	if out := e.mustWt("ls"); !strings.Contains(out, "No active sessions") {
+		t.Errorf("sessions remain after rm --all:\n%s", out)
+	}
+	if e.branchExists("wt-one") || e.branchExists("wt-two") {
+		t.Error("session branches should be deleted")
+	}
+}
+
+func TestIntegrationOutsideRepo(t *testing.T) {
+	e := newTestEnv(t)
+	e.repo = e.home
+
+	out, code := e.wt("ls")
+	if code != exitNotARepo || !strings.Contains(out, "not in a git repository") {
+		t.Errorf("wt ls outside a repo = %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationFetchTimeout(t *testing.T) {
+	e := newTestEnv(t)
+	// An ssh remote whose transport never answers, like a dead host
+	e.git(e.repo, "remote", "set-url", "origin", "ssh://git@example.invalid/repo.git")
+	e.git(e.repo, "config", "core.sshCommand", "sleep 60 && true")
+	e.git(e.repo, "config", "wt.fetchTimeout", "1s")
+
+	start := time.Now()
+	out := e.mustWt("new", "stuck")
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("wt new took %s despite the fetch timeout", elapsed)
+	}
+	if !strings.Contains(out, "timed out after 1s") {
+		t.Errorf("expected a timeout warning:\n%s", out)
+	}
+	if _, err := os.Stat(e.sessionPath("stuck")); err != nil {
+		t.Errorf("session should be created after the fetch times out: %v", err)
+	}
+}
+
+func TestIntegrationInvalidConfig(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.fetchTimeout", "forever")
+
+	out, code := e.wt("ls")
+	if code != exitError || !strings.Contains(out, "wt.fetchtimeout") {
+		t.Errorf("wt ls with bad config = %d:\n%s", code, out)
+	}
+}
+
+// pushUpstreamCommit pushes a commit adding upstream.txt to origin's main
+// from a separate clone
+func (e *testEnv) pushUpstreamCommit() {
+	e.t.Helper()
+	other := filepath.Join(filepath.Dir(e.repo), "other")
+	e.git(filepath.Dir(e.repo), "clone", e.origin, other)
+	e.commit(other, "upstream.txt", "upstream change")
+	e.git(other, "push", "origin", "main")
+}
+
+func (e *testEnv) hasUpstreamCommit(name string) bool {
+	_, err := os.Stat(filepath.Join(e.sessionPath(name), "upstream.txt"))
+	return err == nil
+}
+
+func TestIntegrationNewOffline(t *testing.T) {
+	e := newTestEnv(t)
+	e.pushUpstreamCommit()
+
+	out := e.mustWt("new", "--offline", "plane")
+	if !strings.Contains(out, "Skipping fetch") {
+		t.Errorf("expected fetch to be skipped:\n%s", out)
+	}
+	if e.hasUpstreamCommit("plane") {
+		t.Error("offline session should not include unfetched commits")
+	}
+
+	// Offline can also be the configured default, overridden by --fetch
+	e.git(e.repo, "config", "wt.fetch", "false")
+	e.mustWt("new", "still-offline")
+	if e.hasUpstreamCommit("still-offline") {
+		t.Error("wt.fetch=false should skip the fetch")
+	}
+	e.mustWt("new", "online", "--fetch")
+	if !e.hasUpstreamCommit("online") {
+		t.Error("--fetch should override wt.fetch=false")
+	}
+}
+
+func TestIntegrationNewFetchInterval(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.fetchInterval", "1h")
+	e.mustWt("new", "first")
+
+	e.pushUpstreamCommit()
+	out := e.mustWt("new", "second")
+	if !strings.Contains(out, "Skipping fetch of origin/main (fetched") {
+		t.Errorf("expected the recent fetch to be reused:\n%s", out)
+	}
+	if e.hasUpstreamCommit("second") {
+		t.Error("fetch within the interval should be skipped")
+	}
+}
+
+func TestIntegrationNewNonOriginRemote(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "remote", "rename", "origin", "upstream")
+	e.pushUpstreamCommit()
+
+	out := e.mustWt("new", "feature")
+	if !strings.Contains(out, "Fetching upstream/main") {
+		t.Errorf("expected fetch from the configured upstream:\n%s", out)
+	}
+	if !e.hasUpstreamCommit("feature") {
+		t.Error("session should include the upstream remote's latest commit")
+	}
+}
+
+func TestIntegrationNewNoRemote(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "remote", "remove", "origin")
+
+	out := e.mustWt("new", "local")
+	if strings.Contains(out, "Warning") || !strings.Contains(out, "No remote for main") {
+		t.Errorf("a repository without remotes should not warn:\n%s", out)
+	}
+}
+
+func TestIntegrationNewLeavesLocalBranch(t *testing.T) {
+	e := newTestEnv(t)
+	before := e.git(e.repo, "rev-parse", "main")
+	e.pushUpstreamCommit()
+
+	out := e.mustWt("new", "feature")
+	if !strings.Contains(out, "Base: origin/main @ ") {
+		t.Errorf("summary should show the remote base:\n%s", out)
+	}
+	if !e.hasUpstreamCommit("feature") {
+		t.Error("session should start from origin/main")
+	}
+	if after := e.git(e.repo, "rev-parse", "main"); after != before {
+		t.Errorf("local main moved from %s to %s", before, after)
+	}
+	if _, err := os.Stat(filepath.Join(e.repo, "upstream.txt")); err == nil {
+		t.Error("the user's checkout should not be updated")
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.home, ".wt", ".state", "myrepo-feature", "session.json"))
+	if err != nil {
+		t.Fatalf("session metadata not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"base_ref": "origin/main"`) || !strings.Contains(string(data), `"base_mode": "remote"`) {
+		t.Errorf("metadata should record the base:\n%s", data)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "wt-feature@{upstream}")
+	cmd.Dir = e.repo
+	if err := cmd.Run(); err == nil {
+		t.Error("session branch should not track origin/main")
+	}
+}
+
+func TestIntegrationNewLocalBase(t *testing.T) {
+	e := newTestEnv(t)
+	e.pushUpstreamCommit()
+
+	out := e.mustWt("new", "feature", "--base", "local")
+	if !strings.Contains(out, "(local branch)") {
+		t.Errorf("summary should show the local base:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(e.repo, "upstream.txt")); err != nil {
+		t.Error("--base local should fast-forward the checked out branch")
+	}
+	if !e.hasUpstreamCommit("feature") {
+		t.Error("session should include the fast-forwarded commit")
+	}
+
+	if out, code := e.wt("new", "bad", "--base", "sideways"); code == 0 {
+		t.Errorf("invalid --base should fail:\n%s", out)
+	}
+}
+
+func TestIntegrationNewUnpushedCommitsNote(t *testing.T) {
+	e := newTestEnv(t)
+	e.commit(e.repo, "local.txt", "local only")
+
+	out := e.mustWt("new", "feature")
+	if !strings.Contains(out, "main has 1 commit(s) not in origin/main") {
+		t.Errorf("expected a note about unpushed commits:\n%s", out)
+	}
+}
+
+func TestIntegrationNewAgentMissing(t *testing.T) {
+	e := newTestEnv(t)
+	if err := os.Remove(filepath.Join(filepath.Dir(e.log), "bin", "claude")); err != nil {
+		t.Fatal(err)
+	}
+	// Keep git and sh reachable but drop anything else named claude
+	e.env = append(e.env, "PATH="+filepath.Join(filepath.Dir(e.log), "bin")+":/usr/bin:/bin")
+
+	out, code := e.wt("new", "feature")
+	if code == 0 {
+		t.Fatalf("wt new without an agent should fail:\n%s", out)
+	}
+	if _, err := os.Stat(e.sessionPath("feature")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("session should be removed when the agent can't run: %v", err)
+	}
+	if e.branchExists("wt-feature") {
+		t.Error("branch should be removed when the agent can't run")
+	}
+}
+
+func TestIntegrationNewAgentMissingKeepsExistingBranch(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "branch", "wt-feature")
+	if err := os.Remove(filepath.Join(filepath.Dir(e.log), "bin", "claude")); err != nil {
+		t.Fatal(err)
+	}
+	e.env = append(e.env, "PATH="+filepath.Join(filepath.Dir(e.log), "bin")+":/usr/bin:/bin")
+
+	if out, code := e.wt("new", "feature"); code == 0 {
+		t.Fatalf("wt new without an agent should fail:\n%s", out)
+	}
+	if _, err := os.Stat(e.sessionPath("feature")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("worktree should be rolled back: %v", err)
+	}
+	if !e.branchExists("wt-feature") {
+		t.Error("a branch that existed before wt new should be kept")
+	}
+}
+
+// foreignShell stands in for a shell without POSIX syntax, like fish or
+// nushell, that has claude only as an alias
+const foreignShell = `#!/bin/sh
+case "$3" in
+*'||'* | *'>&'* | *'exec '*)
+	echo "foreignshell: parse error" >&2
+	exit 2
+	;;
+esac
+claude() { "$WT_TEST_AGENT" "$@"; }
+eval "$3"
+`
+
+func TestIntegrationNewForeignShell(t *testing.T) {
+	e := newTestEnv(t)
+	bin := filepath.Join(filepath.Dir(e.log), "bin")
+	agent := filepath.Join(e.home, "agent")
+	if err := os.Rename(filepath.Join(bin, "claude"), agent); err != nil {
+		t.Fatal(err)
+	}
+	writeScript(t, filepath.Join(bin, "fakeshell"), foreignShell)
+	e.env = append(e.env, "WT_TEST_AGENT="+agent, "PATH="+bin+":/usr/bin:/bin")
+
+	e.mustWt("new", "feature")
+	if _, err := os.Stat(e.sessionPath("feature")); err != nil {
+		t.Errorf("session should be kept: %v", err)
+	}
+	launches := e.launches()
+	if len(launches) == 0 || !strings.Contains(launches[len(launches)-1], "dir="+e.sessionPath("feature")+" ") {
+		t.Errorf("agent should be launched in the session through the alias, got %q", launches)
+	}
+}
+
+func TestIntegrationNewAgentExit127KeepsSession(t *testing.T) {
+	e := newTestEnv(t)
+	// The agent itself runs, commits, then exits with 127
+	agent := "#!/bin/sh\necho work > work.txt && git add work.txt && git commit -qm work\nexit 127\n"
+	writeScript(t, filepath.Join(filepath.Dir(e.log), "bin", "claude"), agent)
+
+	if _, code := e.wt("new", "feature"); code == 0 {
+		t.Error("wt new should report the agent's failure")
+	}
+	if _, err := os.Stat(e.sessionPath("feature")); err != nil {
+		t.Errorf("session should be kept once the agent ran: %v", err)
+	}
+	if !e.branchExists("wt-feature") {
+		t.Error("branch with the agent's commits should be kept")
+	}
+}
+
+func TestIntegrationNewRecoversFromKill(t *testing.T) {
+	e := newTestEnv(t)
+	// Make checkout slow while the marker exists, so wt can be killed mid-way
+	marker := filepath.Join(e.home, "slow")
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := fmt.Sprintf("#!/bin/sh\n[ -e %q ] && sleep 2\nexit 0\n", marker)
+	writeScript(t, filepath.Join(e.repo, ".git", "hooks", "post-checkout"), hook)
+
+	cmd := exec.Command(wtBinary, "new", "victim")
+	cmd.Dir = e.repo
+	cmd.Env = e.env
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	journal := filepath.Join(e.home, ".wt", ".state", "myrepo-victim", "journal.json")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(journal)
+		if strings.Contains(string(data), `"worktree"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			t.Fatal("wt never reached the worktree step")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	// Let the orphaned git finish its checkout
+	time.Sleep(2500 * time.Millisecond)
+
+	out := e.mustWt("new", "survivor")
+	if !strings.Contains(out, "Rolling back interrupted creation of session 'victim'") {
+		t.Errorf("expected recovery of the killed creation:\n%s", out)
+	}
+	if _, err := os.Stat(e.sessionPath("victim")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("victim worktree should be rolled back: %v", err)
+	}
+	if e.branchExists("wt-victim") {
+		t.Error("victim branch should be rolled back")
+	}
+	if out := e.mustWt("ls"); strings.Contains(out, "victim") {
+		t.Errorf("victim should not be listed:\n%s", out)
+	}
+}
+
+func TestIntegrationNewConcurrent(t *testing.T) {
+	e := newTestEnv(t)
+	const n = 5
+
+	// Start every wt before waiting on any, so they contend for the lock
+	cmds := make([]*exec.Cmd, n)
+	outs := make([]bytes.Buffer, n)
+	for i := range cmds {
+		cmd := exec.Command(wtBinary, "new", fmt.Sprintf("par%d", i))
+		cmd.Dir = e.repo
+		cmd.Env = e.env
+		cmd.Stdout = &outs[i]
+		cmd.Stderr = &outs[i]
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds[i] = cmd
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("wt new par%d: %v\n%s", i, err, outs[i].String())
+		}
+	}
+
+	out := e.mustWt("ls")
+	for i := range n {
+		name := fmt.Sprintf("par%d", i)
+		if !strings.Contains(out, name) {
+			t.Errorf("session %s missing from ls:\n%s", name, out)
+		}
+		if !e.branchExists("wt-" + name) {
+			t.Errorf("branch wt-%s missing", name)
+		}
+	}
+}
+
+func TestIntegrationLockTimeout(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.lockTimeout", "300ms")
+
+	// Hold the repository lock from outside, like a long-running wt would
+	if _, err := exec.LookPath("flock"); err != nil {
+		t.Skip("flock not available")
+	}
+	holder := exec.Command("flock", filepath.Join(e.repo, ".git", "wt.lock"), "sleep", "5")
+	if err := holder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = holder.Process.Kill()
+		_ = holder.Wait()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	out, code := e.wt("new", "blocked")
+	if code != 9 {
+		t.Fatalf("exit code = %d, want 9:\n%s", code, out)
+	}
+	if !strings.Contains(out, "Waiting for another wt process") {
+		t.Errorf("expected a waiting message:\n%s", out)
+	}
+	if e.branchExists("wt-blocked") {
+		t.Error("nothing should be created without the lock")
+	}
+}
+
+func TestIntegrationNewCount(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.setup", `echo "$WT_SESSION" > setup-ran`)
+
+	out := e.mustWt("new", "try", "--count", "3")
+	if n := strings.Count(out, "Fetching "); n != 1 {
+		t.Errorf("fetched %d times, want once:\n%s", n, out)
+	}
+	if len(e.launches()) != 0 {
+		t.Errorf("no agent should be launched for a batch, got %v", e.launches())
+	}
+
+	base := e.git(e.repo, "rev-parse", "origin/main")
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("try-%d", i)
+		if got := e.git(e.repo, "rev-parse", "wt-"+name); got != base {
+			t.Errorf("wt-%s = %s, want %s", name, got, base)
+		}
+		data, err := os.ReadFile(filepath.Join(e.sessionPath(name), "setup-ran"))
+		if err != nil || strings.TrimSpace(string(data)) != name {
+			t.Errorf("setup should have run in %s: %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestIntegrationNewSetupFailure(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.setup", `[ "$WT_SESSION" != try-2 ]`)
+
+	out, code := e.wt("new", "try", "--count", "2")
+	if code == 0 {
+		t.Fatalf("wt new should fail when a setup command fails:\n%s", out)
+	}
+	for _, name := range []string{"try-1", "try-2"} {
+		if _, err := os.Stat(e.sessionPath(name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s should be rolled back: %v", name, err)
+		}
+		if e.branchExists("wt-" + name) {
+			t.Errorf("wt-%s should be rolled back", name)
+		}
+	}
+}
+
+func TestIntegrationNewPrompt(t *testing.T) {
+	e := newTestEnv(t)
+	prompt := `Fix the "login" test, don't touch $HOME`
+
+	e.mustWt("new", "fix", "--prompt", prompt)
+
+	launches := e.launches()
+	want := fmt.Sprintf("agent dir=%s args=--add-dir %s -- %s", e.sessionPath("fix"), e.repo, prompt)
+	if len(launches) != 1 || launches[0] != want {
+		t.Errorf("launches = %q, want %q", launches, want)
+	}
+	if out := e.mustWt("ls"); !strings.Contains(out, `Fix the "login" test`) {
+		t.Errorf("ls should show the prompt:\n%s", out)
+	}
+}
+
+func TestIntegrationNewPromptFromStdin(t *testing.T) {
+	e := newTestEnv(t)
+	setsid, err := exec.LookPath("setsid")
+	if err != nil {
+		t.Skip("setsid not found")
+	}
+
+	// Without a controlling terminal, the agent would only get the
+	// exhausted stdin
+	cmd := exec.Command(setsid, wtBinary, "new", "fix", "--prompt-file", "-")
+	cmd.Dir = e.repo
+	cmd.Env = e.env
+	cmd.Stdin = strings.NewReader("Fix CI\n")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "no input without a terminal") {
+		t.Fatalf("wt new --prompt-file - without a terminal should fail: %v\n%s", err, out)
+	}
+	if e.branchExists("wt-fix") || len(e.launches()) > 0 {
+		t.Error("no session should be created or agent launched")
+	}
+
+	cmd = exec.Command(wtBinary, "new", "fix", "--prompt-file", "-", "--bg")
+	cmd.Dir = e.repo
+	cmd.Env = e.env
+	cmd.Stdin = strings.NewReader("Fix CI\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("wt new --prompt-file - --bg: %v\n%s", err, out)
+	}
+	e.waitForFile(e.stateFile("fix", "agent.exit"))
+	if launches := e.launches(); len(launches) != 1 || !strings.HasSuffix(launches[0], "--print -- Fix CI") {
+		t.Errorf("launches = %q, want the prompt from stdin", launches)
+	}
+}
+
+// waitForFile waits until path exists
+func (e *testEnv) waitForFile(path string) {
+	e.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			e.t.Fatalf("%s never appeared", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (e *testEnv) stateFile(name, file string) string {
+	return filepath.Join(e.home, ".wt", ".state", "myrepo-"+name, file)
+}
+
+func TestIntegrationNewBackground(t *testing.T) {
+	e := newTestEnv(t)
+
+	out := e.mustWt("new", "ci", "-p", "Fix CI", "--bg")
+	if !strings.Contains(out, "Agent running in the background") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	e.waitForFile(e.stateFile("ci", "agent.exit"))
+
+	launches := e.launches()
+	want := fmt.Sprintf("agent dir=%s args=--add-dir %s --print -- Fix CI", e.sessionPath("ci"), e.repo)
+	if len(launches) != 1 || launches[0] != want {
+		t.Errorf("launches = %q, want %q", launches, want)
+	}
+	if out := e.mustWt("logs", "ci"); !strings.Contains(out, "agent working\nagent done") {
+		t.Errorf("logs should show the agent's output:\n%s", out)
+	}
+	if data, _ := os.ReadFile(e.stateFile("ci", "agent.exit")); strings.TrimSpace(string(data)) != "0" {
+		t.Errorf("exit status = %q, want 0", data)
+	}
+}
+
+func TestIntegrationBackgroundNeedsPrompt(t *testing.T) {
+	e := newTestEnv(t)
+
+	out, code := e.wt("new", "ci", "--bg")
+	if code == 0 || !strings.Contains(out, "needs a prompt") {
+		t.Fatalf("wt new --bg without a prompt should fail, got %d:\n%s", code, out)
+	}
+	if e.branchExists("wt-ci") {
+		t.Error("no session should be created")
+	}
+}
+
+func TestIntegrationRunAndFollowLogs(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "ci", "-p", "Fix CI")
+	e.env = append(e.env, "WT_TEST_AGENT_SLEEP=1")
+
+	e.mustWt("run", "ci")
+	out := e.mustWt("logs", "ci", "-f")
+	if !strings.Contains(out, "agent done") {
+		t.Errorf("logs -f should follow until the agent finishes:\n%s", out)
+	}
+
+	launches := e.launches()
+	if len(launches) != 2 || !strings.HasSuffix(launches[1], "--print -- Fix CI") {
+		t.Errorf("wt run should reuse the session's prompt, launches = %q", launches)
+	}
+}
+
+func TestIntegrationRmStopsBackgroundAgent(t *testing.T) {
+	e := newTestEnv(t)
+	e.env = append(e.env, "WT_TEST_AGENT_SLEEP=30")
+	e.mustWt("new", "ci", "-p", "Fix CI", "--bg")
+	e.waitForFile(e.stateFile("ci", "agent.pid"))
+
+	out, code := e.wt("rm", "ci")
+	if code == 0 || !strings.Contains(out, "already running") {
+		t.Fatalf("rm should refuse while the agent runs, got %d:\n%s", code, out)
+	}
+
+	data, err := os.ReadFile(e.stateFile("ci", "agent.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.mustWt("rm", "--force", "ci")
+
+	pid := strings.TrimSpace(string(data))
+	deadline := time.Now().Add(5 * time.Second)
+	for exec.Command("kill", "-0", pid).Run() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("agent %s still running after rm --force", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestIntegrationRunConcurrent(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "ci", "-p", "Fix CI")
+	e.env = append(e.env, "WT_TEST_AGENT_SLEEP=30")
+
+	// Both pass any check of the PID file at once; only one gets the lock
+	codes := make(chan int, 2)
+	for range 2 {
+		go func() {
+			_, code := e.wt("run", "ci")
+			codes <- code
+		}()
+	}
+	started := 0
+	for range 2 {
+		if <-codes == 0 {
+			started++
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d of two concurrent runs started an agent, want 1", started)
+	}
+	e.mustWt("rm", "--force", "ci")
+}
+
+func TestIntegrationStalePID(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "ci")
+
+	// An agent killed with -9 leaves its PID behind, which an unrelated
+	// process may get next
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = other.Process.Kill() })
+	exited := make(chan error, 1)
+	go func() { exited <- other.Wait() }()
+	if err := os.Remove(e.stateFile("ci", "agent.exit")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(e.stateFile("ci", "agent.pid"), fmt.Appendf(nil, "%d\n", other.Process.Pid), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := e.mustWt("ls"); !strings.Contains(out, "killed") {
+		t.Errorf("ls should report the agent killed:\n%s", out)
+	}
+	e.mustWt("rm", "--force", "ci")
+	select {
+	case err := <-exited:
+		t.Errorf("rm --force signalled the process that reused the PID: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestIntegrationTmux(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not available")
+	}
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.mux", "tmux")
+	// A private tmux server, and an agent that stays up long enough to see
+	e.env = append(e.env, "TMUX_TMPDIR="+t.TempDir(), "TMUX=", "WT_TEST_AGENT_SLEEP=30")
+	tmux := func(args ...string) error {
+		cmd := exec.Command("tmux", args...)
+		cmd.Env = e.env
+		return cmd.Run()
+	}
+	t.Cleanup(func() { _ = tmux("kill-server") })
+
+	out := e.mustWt("new", "feat")
+	if !strings.Contains(out, "Attach with: wt attach feat") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if err := tmux("has-session", "-t", "=wt-myrepo-feat"); err != nil {
+		t.Fatalf("expected a tmux session for feat: %v", err)
+	}
+	e.waitForFile(e.log)
+	if launches := e.launches(); len(launches) != 1 || !strings.Contains(launches[0], e.sessionPath("feat")) {
+		t.Errorf("launches = %q", launches)
+	}
+
+	if out := e.mustWt("ls"); !strings.Contains(out, "live") {
+		t.Errorf("ls should show the live window:\n%s", out)
+	}
+	if out := e.mustWt("fg", "feat"); !strings.Contains(out, "already running") {
+		t.Errorf("fg should reuse the window:\n%s", out)
+	}
+
+	// The window's agent records its PID, so rm won't pull the worktree out
+	// from under it
+	if out, code := e.wt("rm", "feat"); code == 0 || !strings.Contains(out, "already running") {
+		t.Errorf("rm should refuse while the agent runs, got %d:\n%s", code, out)
+	}
+	if out, code := e.wt("run", "feat", "-p", "more"); code == 0 || !strings.Contains(out, "already running") {
+		t.Errorf("run should refuse while the window's agent runs, got %d:\n%s", code, out)
+	}
+
+	e.mustWt("rm", "--force", "feat")
+	if err := tmux("has-session", "-t", "=wt-myrepo-feat"); err == nil {
+		t.Error("rm should kill the tmux session")
+	}
+}
+
+func TestIntegrationAttachWithoutMux(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feat")
+
+	out, code := e.wt("attach", "feat")
+	if code == 0 || !strings.Contains(out, "wt.mux") {
+		t.Errorf("attach without a multiplexer should fail, got %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationAgentState(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "try", "--count", "2")
+	e.mustWt("fg", "try-1")
+
+	// agentStates maps each session in ls to its agent state
+	agentStates := func() map[string]string {
+		states := map[string]string{}
+		for _, line := range strings.Split(e.mustWt("ls"), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 5 {
+				states[fields[1]] = fields[4]
+			}
+		}
+		return states
+	}
+	if states := agentStates(); states["try-1"] != "exited(0)" || states["try-2"] != "idle" {
+		t.Errorf("agent states = %v, want try-1 exited(0) and try-2 idle", states)
+	}
+
+	// Keep an agent running in try-2, as if in another terminal
+	e.env = append(e.env, "WT_TEST_AGENT_SLEEP=3")
+	first := exec.Command(wtBinary, "fg", "try-2")
+	first.Dir = e.repo
+	first.Env = e.env
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = first.Process.Kill()
+		_ = first.Wait()
+	}()
+	e.waitForFile(e.stateFile("try-2", "agent.pid"))
+
+	if states := agentStates(); states["try-2"] != "running" {
+		t.Errorf("agent states = %v, want try-2 running", states)
+	}
+	out, code := e.wt("fg", "try-2")
+	if code == 0 || !strings.Contains(out, "already running") {
+		t.Errorf("a second fg should be refused, got %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationShow(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "feat", "-p", "Add the feature")
+	path := e.sessionPath("feat")
+	e.commit(path, "feature.txt", "Add feature")
+	if err := os.WriteFile(filepath.Join(path, "scratch.txt"), []byte("wip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := e.mustWt("show", "feat")
+	for _, want := range []string{"Branch:   wt-feat", "origin/main @ ", "Add feature", "1 ahead, 0 behind origin/main", "uncommitted changes", "exited(0)", "Add the feature"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("show should include %q:\n%s", want, out)
+		}
+	}
+
+	var details struct {
+		Name        string `json:"name"`
+		HeadSubject string `json:"head_subject"`
+		Ahead       int    `json:"ahead"`
+		Dirty       bool   `json:"dirty"`
+		DiskUsage   int64  `json:"disk_usage_bytes"`
+	}
+	if err := json.Unmarshal([]byte(e.mustWt("show", "feat", "--json")), &details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Name != "feat" || details.HeadSubject != "Add feature" || details.Ahead != 1 || !details.Dirty || details.DiskUsage == 0 {
+		t.Errorf("show --json = %+v", details)
+	}
+}
+
+func TestIntegrationPickWithoutTerminal(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "one")
+	e.mustWt("new", "two")
+
+	for _, command := range []string{"fg", "cd", "rm"} {
+		out, code := e.wt(command)
+		if code != exitUsage {
+			t.Errorf("wt %s exited %d, want %d:\n%s", command, code, exitUsage, out)
+		}
+		for _, want := range []string{"wt-one", "wt-two", "session name required"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("wt %s output lacks %q:\n%s", command, want, out)
+			}
+		}
+	}
+}
+
+func TestIntegrationFindByTagAndBranch(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "docs", "--tag", "frontend", "-t", "q3")
+	e.mustWt("new", "api")
+
+	out := e.mustWt("show", "front")
+	if !strings.Contains(out, "Session:  docs") || !strings.Contains(out, "frontend, q3") {
+		t.Errorf("wt show front:\n%s", out)
+	}
+	if out := e.mustWt("show", "wt-api"); !strings.Contains(out, "Session:  api") {
+		t.Errorf("wt show wt-api:\n%s", out)
+	}
+
+	out, code := e.wt("show", "wt-")
+	if code != exitAmbiguous || !strings.Contains(out, "wt-docs") || !strings.Contains(out, "wt-api") {
+		t.Errorf("wt show wt- = %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationSelectors(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustWt("new", "one")
+	e.mustWt("new", "two")
+	e.mustWt("fg", "one")
+
+	for selector, want := range map[string]string{"1": "one", "2": "two", "-": "one", "@prev": "two"} {
+		if out := e.mustWt("show", selector); !strings.Contains(out, "Session:  "+want) {
+			t.Errorf("wt show %s:\n%s", selector, out)
+		}
+	}
+
+	// From inside a session's worktree, wt still sees the repository's
+	// sessions, and @ is the one it's in
+	dir := filepath.Join(e.sessionPath("two"), "sub")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(wtBinary, "show", "@")
+	cmd.Dir = dir
+	cmd.Env = e.env
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "Session:  two") {
+		t.Errorf("wt show @ in %s: %v\n%s", dir, err, out)
+	}
+
+	if out, code := e.wt("show", "@"); code != exitNotFound {
+		t.Errorf("wt show @ outside sessions = %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationSessionNames(t *testing.T) {
+	e := newTestEnv(t)
+
+	out, code := e.wt("new", "../../escape")
+	if code != exitUsage || !strings.Contains(out, "invalid session name") {
+		t.Errorf("wt new ../../escape = %d:\n%s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(e.home, "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("nothing should be created outside ~/.wt: %v", err)
+	}
+
+	e.mustWt("new", "auth/login")
+	if !e.branchExists("wt-auth/login") {
+		t.Error("branch wt-auth/login should exist")
+	}
+	if _, err := os.Stat(filepath.Join(e.home, ".wt", "myrepo-auth~login")); err != nil {
+		t.Errorf("worktree should be in myrepo-auth~login: %v", err)
+	}
+	if out := e.mustWt("ls"); !strings.Contains(out, "auth/login") {
+		t.Errorf("ls should show auth/login:\n%s", out)
+	}
+
+	e.mustWt("new", "--slugify", "Fix the Login Bug")
+	if !e.branchExists("wt-fix-the-login-bug") {
+		t.Error("--slugify should create wt-fix-the-login-bug")
+	}
+
+	e.mustWt("rm", "auth/login")
+	if e.branchExists("wt-auth/login") {
+		t.Error("branch wt-auth/login should be deleted")
+	}
+}
+
+func TestIntegrationNameGenerators(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.names", "counter")
+	e.mustWt("new")
+	e.mustWt("new")
+	for _, branch := range []string{"wt-session-1", "wt-session-2"} {
+		if !e.branchExists(branch) {
+			t.Errorf("branch %s should exist", branch)
+		}
+	}
+
+	e.git(e.repo, "config", "wt.names", "prompt")
+	e.mustWt("new", "-p", "Fix ABC-7: crash on start")
+	e.mustWt("new", "-p", "Look at ABC-7 again")
+	for _, branch := range []string{"wt-abc-7", "wt-abc-7-2"} {
+		if !e.branchExists(branch) {
+			t.Errorf("branch %s should exist", branch)
+		}
+	}
+}
+
+func TestIntegrationNameCounterConcurrent(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.names", "counter")
+
+	// Each name is generated and taken under the repository lock
+	const n = 3
+	codes := make(chan int, n)
+	for range n {
+		go func() {
+			_, code := e.wt("new")
+			codes <- code
+		}()
+	}
+	for range n {
+		if code := <-codes; code != 0 {
+			t.Errorf("a concurrent wt new exited %d", code)
+		}
+	}
+	for i := 1; i <= n; i++ {
+		if branch := fmt.Sprintf("wt-session-%d", i); !e.branchExists(branch) {
+			t.Errorf("branch %s should exist", branch)
+		}
+	}
+}
+
+func TestIntegrationSparse(t *testing.T) {
+	e := newTestEnv(t)
+	for _, dir := range []string{"services/api", "services/web", "docs"} {
+		if err := os.MkdirAll(filepath.Join(e.repo, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		e.commit(e.repo, filepath.Join(dir, "main.txt"), "add "+dir)
+	}
+	e.git(e.repo, "push", "origin", "main")
+
+	e.mustWt("new", "api", "--sparse", "services/api/")
+	path := e.sessionPath("api")
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(path, rel))
+		return err == nil
+	}
+	for rel, want := range map[string]bool{"README.md": true, "services/api/main.txt": true, "services/web": false, "docs": false} {
+		if exists(rel) != want {
+			t.Errorf("%s exists = %v, want %v", rel, !want, want)
+		}
+	}
+	if out := e.git(path, "status", "--porcelain"); out != "" {
+		t.Errorf("sparse session should be clean:\n%s", out)
+	}
+
+	e.mustWt("sparse", "add", "api", "docs")
+	if !exists("docs/main.txt") {
+		t.Error("wt sparse add should check out docs")
+	}
+	if out := e.mustWt("sparse", "list", "api"); out != "docs\nservices/api\n" {
+		t.Errorf("wt sparse list = %q", out)
+	}
+	if out := e.mustWt("show", "api"); !strings.Contains(out, "services/api, docs") {
+		t.Errorf("show should list the sparse directories:\n%s", out)
+	}
+
+	// The configured default applies unless overridden
+	e.git(e.repo, "config", "wt.sparse", "docs")
+	e.mustWt("new", "docs")
+	e.mustWt("new", "full", "--no-sparse")
+	if _, err := os.Stat(filepath.Join(e.sessionPath("docs"), "services")); err == nil {
+		t.Error("wt.sparse should apply to new sessions")
+	}
+	if _, err := os.Stat(filepath.Join(e.sessionPath("full"), "services/web/main.txt")); err != nil {
+		t.Errorf("--no-sparse should check out everything: %v", err)
+	}
+	if _, code := e.wt("sparse", "add", "full", "docs"); code == 0 {
+		t.Error("wt sparse add on a full checkout should fail")
+	}
+	if _, err := os.Stat(filepath.Join(e.repo, "services/web/main.txt")); err != nil {
+		t.Errorf("the main checkout should stay complete: %v", err)
+	}
+
+	e.mustWt("rm", "api")
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sparse session should be removed: %v", err)
+	}
+}
+
+func TestIntegrationSubmodules(t *testing.T) {
+	e := newTestEnv(t)
+	// Git only clones submodules over the file transport when allowed to
+	e.git(e.home, "config", "--global", "protocol.file.allow", "always")
+	lib := filepath.Join(filepath.Dir(e.repo), "lib")
+	e.git(e.home, "init", "-b", "main", lib)
+	e.commit(lib, "lib.txt", "lib")
+	e.git(e.repo, "submodule", "add", lib, "vendor/lib")
+	e.git(e.repo, "commit", "-m", "add lib")
+	e.git(e.repo, "push", "origin", "main")
+
+	e.mustWt("new", "sub", "--submodules")
+	path := e.sessionPath("sub")
+	if _, err := os.Stat(filepath.Join(path, "vendor/lib/lib.txt")); err != nil {
+		t.Fatalf("submodule should be checked out: %v", err)
+	}
+	// Objects are copied from the main checkout's clone of the submodule,
+	// which the session's clone must not keep depending on
+	alternates := e.git(filepath.Join(path, "vendor/lib"), "rev-parse", "--path-format=absolute", "--git-path", "objects/info/alternates")
+	if data, err := os.ReadFile(alternates); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("submodule should not stay linked to the main checkout: %q, %v", data, err)
+	}
+
+	e.git(filepath.Join(path, "vendor/lib"), "commit", "--allow-empty", "-m", "local only")
+	e.git(path, "commit", "-am", "bump lib")
+	if out, code := e.wt("rm", "sub"); code != exitDirty || !strings.Contains(out, "vendor/lib") {
+		t.Errorf("wt rm with unpushed submodule commits = %d:\n%s", code, out)
+	}
+	// Scripts removing everything must notice what was left behind
+	if out, code := e.wt("rm", "--all"); code != exitDirty || !strings.Contains(out, "1 of 1 sessions not removed: sub") {
+		t.Errorf("wt rm --all with unpushed submodule commits = %d:\n%s", code, out)
+	}
+	e.mustWt("rm", "--force", "sub")
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("session should be removed: %v", err)
+	}
+
+	// Submodules are opt-in
+	e.mustWt("new", "bare")
+	if _, err := os.Stat(filepath.Join(e.sessionPath("bare"), "vendor/lib/lib.txt")); err == nil {
+		t.Error("submodules should be left uninitialized by default")
+	}
+	e.mustWt("rm", "bare")
+
+	e.git(e.repo, "config", "wt.submodules", "true")
+	e.mustWt("new", "configured")
+	if _, err := os.Stat(filepath.Join(e.sessionPath("configured"), "vendor/lib/lib.txt")); err != nil {
+		t.Errorf("wt.submodules should check out the submodule: %v", err)
+	}
+	e.mustWt("rm", "configured")
+	e.mustWt("new", "skipped", "--no-submodules")
+	if _, err := os.Stat(filepath.Join(e.sessionPath("skipped"), "vendor/lib/lib.txt")); err == nil {
+		t.Error("--no-submodules should leave the submodule uninitialized")
+	}
+	e.mustWt("rm", "skipped")
+}
+
+// fakeLFS stands in for git-lfs, recording its arguments. It can't act as
+// a filter, so the test repository has no files in LFS yet.
+const fakeLFS = `#!/bin/sh
+echo "git-lfs $*" >> "$WT_TEST_LOG"
+`
+
+func TestIntegrationLFS(t *testing.T) {
+	e := newTestEnv(t)
+	writeScript(t, filepath.Join(filepath.Dir(e.repo), "bin", "git-lfs"), fakeLFS)
+	if err := os.WriteFile(filepath.Join(e.repo, ".gitattributes"), []byte("*.bin filter=lfs diff=lfs merge=lfs -text\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e.git(e.repo, "add", ".gitattributes")
+	e.git(e.repo, "commit", "-m", "track models in LFS")
+	e.git(e.repo, "push", "origin", "main")
+
+	e.git(e.repo, "config", "wt.lfs", "skip")
+	e.git(e.repo, "config", "--add", "wt.lfsInclude", "models/**")
+	e.mustWt("new", "skip")
+	e.mustWt("new", "share", "--lfs", "share")
+	e.mustWt("new", "smudge", "--lfs", "smudge")
+
+	launches := strings.Join(e.launches(), "\n")
+	for _, want := range []string{"git-lfs pull --include=models/**", "git-lfs checkout"} {
+		if strings.Count(launches, want) != 1 {
+			t.Errorf("expected %q once, got:\n%s", want, launches)
+		}
+	}
+	if out, code := e.wt("new", "bad", "--lfs", "sometimes"); code == 0 || !strings.Contains(out, "invalid LFS policy") {
+		t.Errorf("wt new --lfs sometimes = %d:\n%s", code, out)
+	}
+}
+
+func TestIntegrationWarmDirectories(t *testing.T) {
+	e := newTestEnv(t)
+	e.commit(e.repo, ".gitignore", "node_modules/\n.venv/")
+	e.git(e.repo, "push", "origin", "main")
+	if err := os.MkdirAll(filepath.Join(e.repo, "node_modules", "left-pad"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(e.repo, "node_modules", "left-pad", "index.js"), []byte("pad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e.git(e.repo, "config", "--add", "wt.warm", "node_modules")
+	e.git(e.repo, "config", "--add", "wt.warm", ".venv:copy")
+	// Setup sees the cloned directory
+	e.git(e.repo, "config", "wt.setup", "test -f node_modules/left-pad/index.js")
+
+	out := e.mustWt("new", "warm")
+	if !strings.Contains(out, "Cloned node_modules by") || !strings.Contains(out, "Skipping warm directory .venv") {
+		t.Errorf("wt new should report the warm directories:\n%s", out)
+	}
+	if out := e.git(e.sessionPath("warm"), "status", "--porcelain"); out != "" {
+		t.Errorf("ignored warm directories should leave the session clean:\n%s", out)
+	}
+
+	// Without node_modules, the setup command fails
+	if out, code := e.wt("new", "cold", "--no-warm"); code == 0 {
+		t.Errorf("wt new --no-warm should leave node_modules out:\n%s", out)
+	}
+}
+
+func TestIntegrationPorts(t *testing.T) {
+	e := newTestEnv(t)
+	e.git(e.repo, "config", "wt.ports", "47200-47219")
+	e.git(e.repo, "config", "wt.portBlock", "10")
+	e.git(e.repo, "config", "wt.setup", `echo "$WT_PORT $WT_PORT_LAST $PORT" > ports`)
+	const portsAgent = `#!/bin/sh
+echo "agent session=$WT_SESSION port=$PORT" >> "$WT_TEST_LOG"
+`
+	const portsShell = `#!/bin/sh
+if [ "$1" = "-i" ] && [ "$2" = "-c" ]; then
+	exec /bin/sh -c "$3"
+fi
+echo "shell session=$WT_SESSION port=$WT_PORT" >> "$WT_TEST_LOG"
+`
+	bin := filepath.Join(filepath.Dir(e.repo), "bin")
+	writeScript(t, filepath.Join(bin, "claude"), portsAgent)
+	writeScript(t, filepath.Join(bin, "fakeshell"), portsShell)
+
+	e.mustWt("new", "alpha")
+	e.mustWt("new", "beta")
+	data, err := os.ReadFile(filepath.Join(e.sessionPath("alpha"), "ports"))
+	if err != nil || strings.TrimSpace(string(data)) != "47200 47209 47200" {
+		t.Errorf("setup should see alpha's ports: %q, %v", data, err)
+	}
+
+	e.mustWt("cd", "alpha")
+	want := []string{
+		"agent session=alpha port=47200",
+		"agent session=beta port=47210",
+		"shell session=alpha port=47200",
+	}
+	if got := e.launches(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("launches = %q, want %q", got, want)
+	}
+	if out := e.mustWt("show", "alpha"); !strings.Contains(out, "47200-47209") {
+		t.Errorf("show should print the session's ports:\n%s", out)
+	}
+
+	// wt rm gives the block back
+	e.mustWt("rm", "-f", "beta")
+	e.mustWt("new", "gamma")
+	data, err = os.ReadFile(filepath.Join(e.sessionPath("gamma"), "ports"))
+	if err != nil || strings.TrimSpace(string(data)) != "47210 47219 47210" {
+		t.Errorf("gamma should get beta's ports back: %q, %v", data, err)
+	}
+}
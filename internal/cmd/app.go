@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/emilrex/wt/internal/config"
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/mux"
+	"github.com/emilrex/wt/internal/session"
+)
+
+// App holds the dependencies shared by all commands
+type App struct {
+	Git      *git.Repo
+	Sessions *session.Manager
+	Config   config.Config
+	// Mux runs agents in multiplexer windows; nil runs them in the terminal
+	Mux    mux.Multiplexer
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewApp returns an App backed by the git binary and the process's standard
+// streams, configured from git config
+func NewApp(ctx context.Context) (*App, error) {
+	repo := git.NewExec()
+	cfg, err := config.Load(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	repo.Timeout = cfg.GitTimeout
+	repo.FetchTimeout = cfg.FetchTimeout
+
+	sessions, err := session.NewManager(repo, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	sessions.LockTimeout = cfg.LockTimeout
+	if sessions.PortRange, err = session.ParsePortRange(cfg.Ports, cfg.PortBlock); err != nil {
+		return nil, err
+	}
+	multiplexer, err := mux.New(cfg.Mux)
+	if err != nil {
+		return nil, err
+	}
+	return &App{
+		Git:      repo,
+		Sessions: sessions,
+		Config:   cfg,
+		Mux:      multiplexer,
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}, nil
+}
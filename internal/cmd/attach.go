@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"github.com/emilrex/wt/internal/mux"
+	"github.com/emilrex/wt/internal/proc"
+	"github.com/emilrex/wt/internal/session"
+	"github.com/emilrex/wt/internal/term"
+)
+
+// errNoMux is returned by commands that only make sense with a multiplexer
+var errNoMux = errors.New("no multiplexer configured: set wt.mux to tmux or zellij")
+
+// RunAttach switches to the multiplexer window of a session
+func (a *App) RunAttach(ctx context.Context, sessionName string) error {
+	if a.Mux == nil {
+		return errNoMux
+	}
+	sess, err := a.Sessions.Find(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+	if !a.Mux.Alive(ctx, windowName(sess)) {
+		return fmt.Errorf("session '%s' has no %s window (start one with wt fg %s)", sess.Name, a.Config.Mux, sess.Name)
+	}
+	a.recordUse(ctx, sess)
+	return a.attachWindow(sess)
+}
+
+// windowName returns the name of a session's multiplexer window
+func windowName(sess *session.Session) string {
+	return mux.WindowName(filepath.Base(sess.Path))
+}
+
+// openWindow starts Claude Code in a new multiplexer window for sess. A
+// plain sh in the window records its PID and the agent's exit status, as for
+// a background run. The multiplexer's server starts it, so it can't inherit
+// the agent lock; a detached lockKeeper holds it instead.
+func (a *App) openWindow(ctx context.Context, sess *session.Session, repoRoot, prompt string, continueConversation bool) error {
+	lock, err := a.claimAgent(ctx, sess)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Close() }()
+	if err := a.Sessions.ClearRun(sess.Path); err != nil {
+		return err
+	}
+
+	files := a.Sessions.RunFiles(sess.Path)
+	agent := shellQuote(userShell()) + " -i -c " +
+		shellQuote(claudeCommand(sess.Path, repoRoot, continueConversation)+promptArg(prompt))
+	script := "echo $$ > " + shellQuote(files.PID) + "; " + agent + "; echo $? > " + shellQuote(files.Exit)
+	argv := slices.Concat([]string{"env"}, a.sessionEnv(ctx, sess), []string{"/bin/sh", "-c", script})
+	_, _ = fmt.Fprintf(a.Stdout, "Launching Claude Code in %s window %s...\n", a.Config.Mux, windowName(sess))
+	if err := a.Mux.Open(ctx, windowName(sess), sess.Path, argv); err != nil {
+		return fmt.Errorf("failed to launch Claude Code: %w", err)
+	}
+
+	keeper := exec.Command("/bin/sh", "-c", lockKeeper, "wt", files.PID, files.Exit)
+	keeper.ExtraFiles = []*os.File{lock}
+	proc.Detach(keeper)
+	if err := keeper.Start(); err != nil {
+		_, _ = fmt.Fprintf(a.Stderr, "Warning: failed to hold the agent lock: %v\n", err)
+		return nil
+	}
+	_ = keeper.Process.Release()
+	return nil
+}
+
+// lockKeeper holds the agent lock, which it inherits, for an agent in a
+// multiplexer window: it waits for the window's sh to record its PID ($1),
+// then until that has exited or recorded the agent's exit status ($2)
+const lockKeeper = `i=0
+while [ ! -s "$1" ] && [ $i -lt 100 ]; do sleep 0.1; i=$((i + 1)); done
+pid=$(cat "$1" 2>/dev/null) || exit 0
+while [ ! -e "$2" ] && kill -0 "$pid" 2>/dev/null; do sleep 1; done`
+
+// attachWindow brings a session's window to the foreground. Without a
+// terminal to attach, it says how to do so later.
+func (a *App) attachWindow(sess *session.Session) error {
+	if !term.IsTerminal(a.Stdin) {
+		_, _ = fmt.Fprintf(a.Stdout, "Attach with: wt attach %s\n", sess.Name)
+		return nil
+	}
+	cmd := a.Mux.Attach(windowName(sess))
+	cmd.Stdin = a.Stdin
+	cmd.Stdout = a.Stdout
+	cmd.Stderr = a.Stderr
+	return cmd.Run()
+}
+
+// killWindows closes the multiplexer windows of sessions that have been
+// removed
+func (a *App) killWindows(ctx context.Context, sessions []session.Session) {
+	if a.Mux == nil {
+		return
+	}
+	for _, s := range sessions {
+		if _, err := os.Stat(s.Path); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if name := windowName(&s); a.Mux.Alive(ctx, name) {
+			if err := a.Mux.Kill(ctx, name); err != nil {
+				_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+}
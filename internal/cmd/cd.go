@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,30 +10,37 @@ import (
 )
 
 // RunCd opens an interactive shell in a session's worktree directory
-func RunCd(sessionName string) error {
-	sess, err := session.Find(sessionName)
+func (a *App) RunCd(ctx context.Context, sessionName string) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Opening shell in session '%s' (%s)\n", sess.Name, sess.Path)
-	fmt.Println("Type 'exit' to return to your original location")
-	fmt.Println()
+	a.recordUse(ctx, sess)
+	_, _ = fmt.Fprintf(a.Stdout, "Opening shell in session '%s' (%s)\n", sess.Name, sess.Path)
+	_, _ = fmt.Fprintln(a.Stdout, "Type 'exit' to return to your original location")
+	_, _ = fmt.Fprintln(a.Stdout)
 
-	// Get user's shell or fall back to /bin/bash
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
-	}
-
-	cmd := exec.Command(shell)
+	cmd := exec.Command(userShell())
 	cmd.Dir = sess.Path
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdin = a.Stdin
+	cmd.Stdout = a.Stdout
+	cmd.Stderr = a.Stderr
 
 	// Set environment to show we're in a wt session
-	cmd.Env = append(os.Environ(), fmt.Sprintf("WT_SESSION=%s", sess.Name))
+	cmd.Env = append(os.Environ(), a.sessionEnv(ctx, sess)...)
 
 	return cmd.Run()
 }
+
+// sessionEnv returns the environment variables that programs started in
+// sess see: WT_SESSION, and PORT, WT_PORT and WT_PORT_LAST for its block of
+// ports if wt.ports is set. Failing to allocate ports is only a warning.
+func (a *App) sessionEnv(ctx context.Context, sess *session.Session) []string {
+	env := []string{"WT_SESSION=" + sess.Name}
+	ports, err := a.Sessions.Ports(ctx, sess)
+	if err != nil {
+		_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", err)
+	}
+	return append(env, ports.Env()...)
+}
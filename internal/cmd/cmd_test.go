@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/git/gittest"
+	"github.com/emilrex/wt/internal/session"
+	"github.com/emilrex/wt/internal/term"
+)
+
+// newTestApp returns an App over a fake git runner for a repository named
+// "myrepo", with its output captured in the returned buffer
+func newTestApp(t *testing.T) (*App, *gittest.Runner, *bytes.Buffer) {
+	t.Helper()
+	runner := &gittest.Runner{}
+	runner.On("rev-parse --show-toplevel", "/src/myrepo\n", nil)
+	runner.On("rev-parse --path-format=absolute --git-common-dir", t.TempDir()+"\n", nil)
+	repo := git.New(runner, io.Discard, io.Discard)
+
+	var out bytes.Buffer
+	app := &App{
+		Git:      repo,
+		Sessions: &session.Manager{Git: repo, BaseDir: t.TempDir(), Out: &out},
+		Stdin:    strings.NewReader(""),
+		Stdout:   &out,
+		Stderr:   &out,
+	}
+	return app, runner, &out
+}
+
+func TestRunLsEmpty(t *testing.T) {
+	app, _, out := newTestApp(t)
+
+	if err := app.RunLs(t.Context()); err != nil {
+		t.Fatalf("RunLs() error: %v", err)
+	}
+	if !strings.Contains(out.String(), "No active sessions") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRunLs(t *testing.T) {
+	app, runner, out := newTestApp(t)
+	path := app.Sessions.WorktreePath("myrepo", "feature")
+	runner.On("worktree list --porcelain", "worktree "+path+"\nHEAD abc\nbranch refs/heads/wt-feature\n", nil)
+
+	if err := app.RunLs(t.Context()); err != nil {
+		t.Fatalf("RunLs() error: %v", err)
+	}
+	if !strings.Contains(out.String(), "feature") || !strings.Contains(out.String(), "wt-feature") {
+		t.Errorf("output = %q, want feature session listed", out.String())
+	}
+}
+
+func TestRunRmRequiresName(t *testing.T) {
+	app, runner, _ := newTestApp(t)
+
+	if err := app.RunRm(t.Context(), RmOptions{}); err == nil {
+		t.Fatal("RunRm() without a name should fail")
+	}
+	if len(runner.Calls()) != 0 {
+		t.Errorf("no git calls expected, got %v", runner.Calls())
+	}
+}
+
+func TestReadPrompt(t *testing.T) {
+	app, _, _ := newTestApp(t)
+	app.Stdin = strings.NewReader("  Fix the login test\n")
+	file := filepath.Join(t.TempDir(), "task.md")
+	if err := os.WriteFile(file, []byte("Write docs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prompt, file string
+		want         string
+	}{
+		{"", "", ""},
+		{"Do it", "", "Do it"},
+		{"", file, "Write docs"},
+		{"", "-", "Fix the login test"},
+	}
+	for _, tt := range tests {
+		got, err := app.readPrompt(tt.prompt, tt.file)
+		if err != nil || got != tt.want {
+			t.Errorf("readPrompt(%q, %q) = %q, %v; want %q", tt.prompt, tt.file, got, err, tt.want)
+		}
+	}
+
+	if _, err := app.readPrompt("a", file); err == nil {
+		t.Error("--prompt with --prompt-file should fail")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	prompt := `it's "$HOME" and $(rm -rf /)`
+	out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(prompt)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != prompt {
+		t.Errorf("sh saw %q, want %q", out, prompt)
+	}
+}
+
+func TestSummarizePrompt(t *testing.T) {
+	tests := map[string]string{
+		"":                      "-",
+		"Fix it\nwith details":  "Fix it",
+		strings.Repeat("a", 60): strings.Repeat("a", 47) + "...",
+	}
+	for prompt, want := range tests {
+		if got := summarizePrompt(prompt); got != want {
+			t.Errorf("summarizePrompt(%q) = %q, want %q", prompt, got, want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+		3 << 30:         "3.0 GiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestRenderDashboard(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	ahead, behind, dirty := 2, 1, true
+	rows := []dashboardRow{
+		{
+			sess:    session.Session{Name: "alpha", Branch: "wt-alpha"},
+			details: sessionDetails{AgentState: "running", Ahead: &ahead, Behind: &behind, Dirty: &dirty, LastActivity: now.Add(-5 * time.Minute), Prompt: "Fix it"},
+		},
+		{
+			sess:    session.Session{Name: "beta", Branch: "wt-beta"},
+			details: sessionDetails{AgentState: "idle"},
+		},
+	}
+
+	screen := renderDashboard(rows, 1, 200, 10, "Removed 'gamma'", now)
+	lines := strings.Split(strings.TrimPrefix(screen, clearScreen), "\n")
+	if len(lines) != 10 {
+		t.Errorf("got %d lines, want the screen height of 10", len(lines))
+	}
+	for _, want := range []string{"2 session(s)", "15:04:05", "wt-alpha", "dirty", "+2 -1", "5m ago", "Fix it", "Removed 'gamma'", "q quit"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen lacks %q:\n%s", want, screen)
+		}
+	}
+	if !strings.Contains(screen, reverseVideo+"> beta") {
+		t.Errorf("beta isn't highlighted:\n%s", screen)
+	}
+
+	narrow := renderDashboard(rows, 0, 20, 10, "", now)
+	for _, line := range strings.Split(strings.TrimPrefix(narrow, clearScreen), "\n") {
+		line = strings.TrimSuffix(strings.TrimPrefix(line, reverseVideo), resetStyle)
+		if n := len([]rune(line)); n > 20 {
+			t.Errorf("line %q is %d runes wide, want at most 20", line, n)
+		}
+	}
+}
+
+func TestPickerKeys(t *testing.T) {
+	p := &picker{lines: []string{"auth-login  wt-auth-login", "auth-signup  wt-auth-signup", "docs  wt-docs"}}
+	p.filter()
+
+	for _, key := range []term.Key{"a", "u", "s", term.KeyBackspace, term.KeyDown, term.KeyDown} {
+		if _, done, _ := p.handle(key); done {
+			t.Fatalf("picker finished early on %q", key)
+		}
+	}
+	if len(p.matches) != 2 {
+		t.Errorf("query %q matches %v, want the two auth sessions", p.query, p.matches)
+	}
+	i, done, err := p.handle(term.KeyEnter)
+	if !done || err != nil || i != 1 {
+		t.Errorf("enter = (%d, %v, %v), want the second line", i, done, err)
+	}
+
+	if _, done, err := p.handle(term.KeyEsc); !done || !errors.Is(err, errNoSelection) {
+		t.Errorf("esc = (%v, %v), want errNoSelection", done, err)
+	}
+}
+
+func TestPickSessionWithoutTerminal(t *testing.T) {
+	app, runner, out := newTestApp(t)
+	path := app.Sessions.WorktreePath("myrepo", "feature")
+	runner.On("worktree list --porcelain", "worktree "+path+"\nHEAD abc\nbranch refs/heads/wt-feature\n", nil)
+
+	_, err := app.PickSession(t.Context(), "fg")
+	if !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("PickSession() error = %v, want ErrNameRequired", err)
+	}
+	if !strings.Contains(out.String(), "wt-feature") {
+		t.Errorf("output = %q, want the sessions listed", out.String())
+	}
+}
+
+func TestDashboardRemoveKeepsOutputInStatusLine(t *testing.T) {
+	app, runner, out := newTestApp(t)
+	path := app.Sessions.WorktreePath("myrepo", "feature")
+	runner.On("worktree list --porcelain", "worktree "+path+"\nHEAD abc\nbranch refs/heads/wt-feature\n", nil)
+	runner.On("branch -D wt-feature", "", gittest.Fail("error: branch 'wt-feature' not found"))
+
+	d := &dashboard{a: app}
+	d.remove(t.Context(), "feature", false)
+	if out.Len() != 0 {
+		t.Errorf("removal printed over the dashboard: %q", out.String())
+	}
+	if !strings.HasPrefix(d.message, "Removed 'feature' (failed to delete branch wt-feature") {
+		t.Errorf("message = %q, want the removal with its warning", d.message)
+	}
+	if app.Sessions.Out != out || app.Stderr != out {
+		t.Error("output should be restored afterwards")
+	}
+}
+
+func TestDashboardForkPoint(t *testing.T) {
+	app, runner, _ := newTestApp(t)
+	runner.On("merge-base origin/main wt-feature", "1111111111111111\n", nil)
+	d := &dashboard{a: app}
+	row := dashboardRow{
+		sess:    session.Session{Name: "feature", Branch: "wt-feature", Meta: session.Metadata{BaseCommit: "2222222222222222"}},
+		details: sessionDetails{CompareRef: "origin/main"},
+	}
+
+	// Commits that reached origin/main since the session forked aren't its
+	if commit, _ := d.forkPoint(t.Context(), row); commit != "1111111111111111" {
+		t.Errorf("forkPoint() = %s, want the merge base", commit)
+	}
+	row.details.CompareRef = ""
+	if commit, _ := d.forkPoint(t.Context(), row); commit != "2222222222222222" {
+		t.Errorf("forkPoint() without a ref = %s, want the base commit", commit)
+	}
+}
+
+func TestDashboardPollerSkipsUnchangedSessions(t *testing.T) {
+	app, runner, _ := newTestApp(t)
+	path := app.Sessions.WorktreePath("myrepo", "feature")
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner.On("worktree list --porcelain", "worktree "+path+"\nHEAD abc\nbranch refs/heads/wt-feature\n", nil)
+	runner.On("-C "+path+" status --porcelain", "?? notes.txt\n", nil)
+	statuses := func() int {
+		n := 0
+		for _, c := range runner.Calls() {
+			if strings.HasSuffix(c, "status --porcelain") {
+				n++
+			}
+		}
+		return n
+	}
+
+	p := newDashboardPoller(app)
+	poll := func() []dashboardRow {
+		t.Helper()
+		rows, err := p.poll(t.Context())
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("poll() = %v, %v; want one row", rows, err)
+		}
+		return rows
+	}
+	if rows := poll(); rows[0].details.Dirty == nil || !*rows[0].details.Dirty || statuses() != 1 {
+		t.Fatalf("first poll should ask git: dirty %v after %d statuses", rows[0].details.Dirty, statuses())
+	}
+	if rows := poll(); rows[0].details.Dirty == nil || statuses() != 1 {
+		t.Errorf("an unchanged session should keep its details without asking git again (%d statuses)", statuses())
+	}
+
+	// Files created in the worktree change its modification time
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if poll(); statuses() != 2 {
+		t.Errorf("a changed session should be checked again (%d statuses)", statuses())
+	}
+}
+
+func TestReportWarm(t *testing.T) {
+	var out bytes.Buffer
+	reportWarm(&out, []session.WarmResult{
+		{Path: "node_modules", Strategy: session.WarmReflink, Size: 3 << 20, Shared: 3 << 20, Elapsed: 120 * time.Millisecond},
+		{Path: ".venv", Strategy: session.WarmCopy, Size: 1 << 20, Elapsed: 2 * time.Second},
+	})
+	want := "Cloned node_modules by reflink in 120ms: 3.0 MiB, 3.0 MiB shared with the main checkout, saving that much disk over a copy\n" +
+		"Cloned .venv by copy in 2s: 1.0 MiB, nothing shared with the main checkout\n" +
+		"Cloned 2 directories (4.0 MiB) in 2.12s, saving 3.0 MiB of disk over copies\n"
+	if out.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", out.String(), want)
+	}
+}
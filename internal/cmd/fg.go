@@ -1,23 +1,61 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/emilrex/wt/internal/session"
 )
 
 // RunFg resumes an existing session by launching Claude Code with --continue
-func RunFg(sessionName string) error {
-	sess, err := session.Find(sessionName)
+func (a *App) RunFg(ctx context.Context, sessionName string) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Resuming session '%s'...\n", sess.Name)
-	fmt.Printf("  Branch: %s\n", sess.Branch)
-	fmt.Printf("  Path: %s\n", sess.Path)
-	fmt.Println()
+	_, _ = fmt.Fprintf(a.Stdout, "Resuming session '%s'...\n", sess.Name)
+	a.printSession(sess)
+	_, _ = fmt.Fprintln(a.Stdout)
+
+	// Switch to the agent's window if it's there
+	if a.Mux != nil && a.Mux.Alive(ctx, windowName(sess)) {
+		a.recordUse(ctx, sess)
+		_, _ = fmt.Fprintf(a.Stdout, "Claude Code is already running in %s window %s\n", a.Config.Mux, windowName(sess))
+		return a.attachWindow(sess)
+	}
+
+	// Two agents editing one worktree would trip over each other
+	status, err := a.Sessions.RunStatus(sess.Path)
+	if err != nil {
+		return err
+	}
+	if status.Running {
+		return fmt.Errorf("session '%s': %w (pid %d)", sess.Name, session.ErrAgentRunning, status.PID)
+	}
+
+	a.recordUse(ctx, sess)
+	sess.Meta.ResumedAt = time.Now()
+	if err := a.Sessions.SaveMetadata(sess.Path, sess.Meta); err != nil {
+		_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", err)
+	}
+
+	if a.Mux != nil {
+		if err := a.openWindow(ctx, sess, "", "", true); err != nil {
+			return err
+		}
+		return a.attachWindow(sess)
+	}
 
 	// Launch Claude Code with --continue using shell for alias support
-	return launchClaude(sess.Path, "", true)
+	return a.launchClaude(ctx, sess, "", true)
+}
+
+// recordUse remembers that the user went into sess, for the - and @prev
+// selectors
+func (a *App) recordUse(ctx context.Context, sess *session.Session) {
+	if err := a.Sessions.RecordUse(ctx, sess.Name); err != nil {
+		_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", err)
+	}
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// logPollInterval is how often wt logs -f checks for new output
+const logPollInterval = 200 * time.Millisecond
+
+// RunLogs prints the output of a session's background agent run. With
+// follow, it keeps printing new output until the run finishes or the user
+// interrupts it.
+func (a *App) RunLogs(ctx context.Context, sessionName string, follow bool) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+
+	log, err := os.Open(a.Sessions.RunFiles(sess.Path).Log)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("session '%s' has no background run (start one with wt run)", sess.Name)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Close() }()
+
+	if _, err := io.Copy(a.Stdout, log); err != nil {
+		return err
+	}
+	if !follow {
+		return nil
+	}
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		// Check before copying, so nothing written before the run ended is missed
+		status, err := a.Sessions.RunStatus(sess.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(a.Stdout, log); err != nil {
+			return err
+		}
+
+		if !status.Running {
+			switch {
+			case !status.Exited:
+				_, _ = fmt.Fprintln(a.Stderr, "Agent was stopped before it finished")
+			case status.ExitCode != 0:
+				_, _ = fmt.Fprintf(a.Stderr, "Agent exited with status %d\n", status.ExitCode)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// Ctrl-C stops following, not the agent
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
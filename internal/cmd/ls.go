@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -10,31 +11,71 @@ import (
 )
 
 // RunLs displays all active sessions for the current repository
-func RunLs() error {
-	sessions, err := session.List()
+func (a *App) RunLs(ctx context.Context) error {
+	sessions, err := a.Sessions.List(ctx)
 	if err != nil {
 		return err
 	}
 
 	if len(sessions) == 0 {
-		fmt.Println("No active sessions")
+		_, _ = fmt.Fprintln(a.Stdout, "No active sessions")
 		return nil
 	}
 
 	// Replace home directory with ~ for display
 	home, _ := os.UserHomeDir()
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(w, "Session\tBranch\tPath")
-	_, _ = fmt.Fprintln(w, "-------\t------\t----")
+	w := tabwriter.NewWriter(a.Stdout, 0, 0, 2, ' ', 0)
+	header, rule := "#\tSession\tBranch\tPath\tAgent\tTask", "-\t-------\t------\t----\t-----\t----"
+	if a.Mux != nil {
+		header, rule = header+"\tWindow", rule+"\t------"
+	}
+	_, _ = fmt.Fprintln(w, header)
+	_, _ = fmt.Fprintln(w, rule)
 
-	for _, s := range sessions {
+	for i, s := range sessions {
 		displayPath := s.Path
 		if home != "" && strings.HasPrefix(s.Path, home) {
 			displayPath = "~" + strings.TrimPrefix(s.Path, home)
 		}
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Branch, displayPath)
+		agent, live := a.agentState(ctx, &s)
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s", i+1, s.Name, s.Branch, displayPath, agent, summarizePrompt(s.Meta.Prompt))
+		if a.Mux != nil {
+			window := "-"
+			if live {
+				window = "live"
+			}
+			_, _ = fmt.Fprintf(w, "\t%s", window)
+		}
+		_, _ = fmt.Fprintln(w)
 	}
 
 	return w.Flush()
 }
+
+// agentState describes whether an agent is working in sess, and whether it
+// has a live multiplexer window
+func (a *App) agentState(ctx context.Context, sess *session.Session) (state string, live bool) {
+	live = a.Mux != nil && a.Mux.Alive(ctx, windowName(sess))
+	if live {
+		return "running", true
+	}
+	status, err := a.Sessions.RunStatus(sess.Path)
+	if err != nil {
+		return "unknown", false
+	}
+	return status.String(), false
+}
+
+// summarizePrompt shortens a session's prompt to fit on one line of a listing
+func summarizePrompt(prompt string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	if line == "" {
+		return "-"
+	}
+	const maxLen = 50
+	if runes := []rune(line); len(runes) > maxLen {
+		return string(runes[:maxLen-3]) + "..."
+	}
+	return line
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 
-	"github.com/emilrex/wt/internal/git"
 	"github.com/emilrex/wt/internal/session"
 )
 
@@ -13,49 +18,450 @@ import (
 type NewOptions struct {
 	Name         string
 	SourceBranch string
+	// Base is "remote" or "local"; empty uses the configured default (--base)
+	Base string
+	// NoFetch skips fetching the source branch (--no-fetch, --offline)
+	NoFetch bool
+	// Fetch fetches even if disabled in config or fetched recently (--fetch)
+	Fetch bool
+	// Count creates this many sessions named <name>-1..<name>-N from the
+	// same commit instead of one (--count)
+	Count int
+	// Prompt is the agent's initial instruction (--prompt)
+	Prompt string
+	// PromptFile is a file holding the initial instruction, or "-" for
+	// standard input (--prompt-file)
+	PromptFile string
+	// Background runs the agent headless in the background instead of in
+	// the terminal; it needs a prompt (--bg)
+	Background bool
+	// Tags label the session so it can be found by them (--tag)
+	Tags []string
+	// Slugify turns Name into a valid session name instead of rejecting it
+	// (--slugify)
+	Slugify bool
+	// Sparse checks out only these directories, replacing the configured
+	// ones (--sparse)
+	Sparse []string
+	// NoSparse checks out everything despite wt.sparse (--no-sparse)
+	NoSparse bool
+	// Submodules checks out submodules even if wt.submodules is unset
+	// (--submodules)
+	Submodules bool
+	// NoSubmodules leaves submodules uninitialized despite wt.submodules
+	// (--no-submodules)
+	NoSubmodules bool
+	// LFS is "smudge", "skip" or "share"; empty uses the configured policy
+	// (--lfs)
+	LFS string
+	// NoWarm skips cloning the configured warm directories (--no-warm)
+	NoWarm bool
 }
 
 // RunNew creates a new worktree session and launches Claude Code
-func RunNew(opts NewOptions) error {
-	// Generate name if not provided
+func (a *App) RunNew(ctx context.Context, opts NewOptions) error {
 	name := opts.Name
-	if name == "" {
-		name = session.GenerateSessionName()
+	if name != "" && (opts.Slugify || a.Config.Slugify) {
+		name = session.Slugify(name)
+		if name == "" {
+			return fmt.Errorf("%w '%s': nothing is left of it as a slug", session.ErrInvalidName, opts.Name)
+		}
 	}
 
 	// Get source branch if not provided
 	sourceBranch := opts.SourceBranch
 	if sourceBranch == "" {
 		var err error
-		sourceBranch, err = git.GetCurrentBranch()
+		sourceBranch, err = a.Git.GetCurrentBranch(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
+	prompt, err := a.readPrompt(opts.Prompt, opts.PromptFile)
+	if err != nil {
+		return err
+	}
+	if opts.Background && prompt == "" {
+		return errNoPrompt
+	}
+	// An agent in this terminal reads its input from stdin, which the
+	// prompt has used up, so it gets the terminal itself
+	if opts.PromptFile == "-" && !opts.Background && a.Mux == nil && opts.Count <= 1 {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return fmt.Errorf("--prompt-file - leaves the agent no input without a terminal; use --bg or wt.mux: %w", err)
+		}
+		defer func() { _ = tty.Close() }()
+		a.Stdin = tty
+	}
+
 	// Get original repo root before creating session
-	repoRoot, err := git.GetRepoRoot()
+	repoRoot, err := a.Git.GetRepoRoot(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Create the session
-	sess, err := session.Create(name, sourceBranch)
+	base := opts.Base
+	if base == "" {
+		base = a.Config.Base
+	}
+	baseMode, err := session.ParseBaseMode(base)
+	if err != nil {
+		return err
+	}
+	lfs := opts.LFS
+	if lfs == "" {
+		lfs = a.Config.LFS
+	}
+	lfsPolicy, err := session.ParseLFSPolicy(lfs)
+	if err != nil {
+		return err
+	}
+	var warmDirs []session.WarmDir
+	if !opts.NoWarm {
+		if warmDirs, err = a.warmDirs(); err != nil {
+			return err
+		}
+	}
+
+	createOpts := session.CreateOptions{
+		Name:          name,
+		SourceBranch:  sourceBranch,
+		Base:          baseMode,
+		Fetch:         a.Config.Fetch,
+		FetchInterval: a.Config.FetchInterval,
+		Prompt:        prompt,
+		Tags:          opts.Tags,
+		Sparse:        a.Config.Sparse,
+		Submodules:    (a.Config.Submodules || opts.Submodules) && !opts.NoSubmodules,
+		LFS:           lfsPolicy,
+		LFSInclude:    a.Config.LFSInclude,
+		// Without a name, one is generated once the repository is locked
+		Names: session.NameOptions{
+			Generator:    a.Config.Names,
+			Template:     a.Config.NameTemplate,
+			Prompt:       prompt,
+			SourceBranch: sourceBranch,
+		},
+	}
+	if len(opts.Sparse) > 0 {
+		createOpts.Sparse = opts.Sparse
+	}
+	if opts.NoSparse {
+		createOpts.Sparse = nil
+	}
+	if opts.Fetch {
+		createOpts.Fetch = true
+		createOpts.FetchInterval = 0
+	}
+	if opts.NoFetch {
+		createOpts.Fetch = false
+	}
+
+	if opts.Count > 1 {
+		return a.runNewBatch(ctx, createOpts, opts.Count, repoRoot, warmDirs, opts.Background)
+	}
+
+	creation, err := a.Sessions.Begin(ctx, createOpts)
 	if err != nil {
 		return err
 	}
+	sess := creation.Session
+	a.recordUse(ctx, sess)
+
+	_, _ = fmt.Fprintf(a.Stdout, "\nSession '%s' created successfully!\n", sess.Name)
+	a.printSession(sess)
+	_, _ = fmt.Fprintln(a.Stdout)
 
-	fmt.Printf("\nSession '%s' created successfully!\n", sess.Name)
-	fmt.Printf("  Branch: %s\n", sess.Branch)
-	fmt.Printf("  Path: %s\n", sess.Path)
-	fmt.Println()
+	if err := a.warm(ctx, creation, warmDirs, a.Stdout); err != nil {
+		_ = creation.Rollback(ctx)
+		return err
+	}
+	if err := creation.Setup(ctx, a.Config.Setup, a.Stdout); err != nil {
+		_ = creation.Rollback(ctx)
+		return err
+	}
 
-	// Launch Claude Code
-	return launchClaude(sess.Path, repoRoot, false)
+	// Launch Claude Code. The session is only complete once the agent is
+	// running; if it can't be started, nothing is left behind.
+	if opts.Background {
+		pid, err := a.startBackground(ctx, sess, repoRoot, prompt)
+		if err != nil {
+			_ = creation.Rollback(ctx)
+			return err
+		}
+		if err := creation.Commit(); err != nil {
+			return err
+		}
+		a.printBackground(sess, pid)
+		return nil
+	}
+
+	if a.Mux != nil {
+		if err := a.openWindow(ctx, sess, repoRoot, prompt, false); err != nil {
+			_ = creation.Rollback(ctx)
+			return err
+		}
+		if err := creation.Commit(); err != nil {
+			return err
+		}
+		return a.attachWindow(sess)
+	}
+
+	// The session stays uncommitted until the shell has found the agent, so
+	// a failed launch rolls back only what this creation made
+	lock, err := a.claimAgent(ctx, sess)
+	if err != nil {
+		_ = creation.Rollback(ctx)
+		return err
+	}
+	agent := a.agentCommand(ctx, sess, repoRoot, prompt, false)
+	agent.ExtraFiles = []*os.File{lock}
+	err = startLaunched(agent)
+	_ = lock.Close()
+	if err != nil {
+		_ = creation.Rollback(ctx)
+		return fmt.Errorf("failed to launch Claude Code: %w", err)
+	}
+	if err := creation.Commit(); err != nil {
+		return err
+	}
+	return a.waitAgent(sess.Path, agent)
+}
+
+// launchCheck runs in /bin/sh, whatever the user's shell ($1) is, before
+// that shell runs the agent's command line ($2). It looks for claude on the
+// PATH, or else asks the user's shell, which may have it as an alias, to
+// run `claude --version`. Once claude is found, it writes a byte to fd 3 and
+// closes it.
+const launchCheck = `command -v claude >/dev/null 2>&1 ||
+	"$1" -i -c "claude --version" </dev/null >/dev/null 2>&1 || exit 127
+printf . >&3
+exec 3>&-
+exec "$1" -i -c "$2"`
+
+// startLaunched starts agent, a command from agentCommand, and waits until
+// Claude Code has been found. The user's shell reports a missing or
+// unrunnable agent with exit status 127 or 126, the same as an agent
+// exiting with those itself could, so the check signals on a pipe instead.
+// It runs in /bin/sh, as the user's shell may not speak POSIX syntax.
+func startLaunched(agent *exec.Cmd) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	agent.ExtraFiles = append([]*os.File{w}, agent.ExtraFiles...)
+	shell := agent.Path
+	agent.Path = "/bin/sh"
+	agent.Args = []string{"sh", "-c", launchCheck, "wt", shell, agent.Args[len(agent.Args)-1]}
+	err = agent.Start()
+	_ = w.Close()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := r.Read(make([]byte, 1)); n == 1 {
+		return nil
+	}
+	// The shell exited without running the agent
+	if err := agent.Wait(); err != nil {
+		return fmt.Errorf("claude not found by %s: %w", shell, err)
+	}
+	return fmt.Errorf("claude not found by %s", shell)
 }
 
-// launchClaude launches Claude Code in the specified directory
-func launchClaude(worktreePath, repoRoot string, continueConversation bool) error {
+// runNewBatch creates count sessions named <name>-1..<name>-N from the same
+// commit, then clones their warm directories and runs their setup commands
+// in parallel. Either all of them are created or none is. With background,
+// each gets an agent running headless on the same prompt.
+func (a *App) runNewBatch(ctx context.Context, opts session.CreateOptions, count int, repoRoot string, warmDirs []session.WarmDir, background bool) error {
+	creations, err := a.Sessions.BeginBatch(ctx, opts, count)
+	if err != nil {
+		return err
+	}
+	rollback := func() {
+		for _, c := range creations {
+			_ = c.Rollback(ctx)
+		}
+	}
+
+	// Setup output is collected per session so parallel runs don't interleave
+	outputs := make([]bytes.Buffer, len(creations))
+	errs := make([]error, len(creations))
+	var wg sync.WaitGroup
+	for i, c := range creations {
+		wg.Go(func() {
+			if errs[i] = a.warm(ctx, c, warmDirs, &outputs[i]); errs[i] == nil {
+				errs[i] = c.Setup(ctx, a.Config.Setup, &outputs[i])
+			}
+		})
+	}
+	wg.Wait()
+	for i := range creations {
+		_, _ = a.Stdout.Write(outputs[i].Bytes())
+	}
+	if err := errors.Join(errs...); err != nil {
+		rollback()
+		return err
+	}
+
+	for _, c := range creations {
+		if err := c.Commit(); err != nil {
+			rollback()
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(a.Stdout, "\nCreated %d sessions:\n", len(creations))
+	for _, c := range creations {
+		_, _ = fmt.Fprintf(a.Stdout, "\n%s\n", c.Session.Name)
+		a.printSession(c.Session)
+	}
+	_, _ = fmt.Fprintln(a.Stdout)
+
+	if !background && a.Mux == nil {
+		_, _ = fmt.Fprintf(a.Stdout, "Open one with: wt cd %s\n", creations[0].Session.Name)
+		return nil
+	}
+	// The sessions are complete by now; an agent that fails to start can be
+	// retried with wt run or wt fg
+	var startErrs []error
+	for _, c := range creations {
+		if !background {
+			if err := a.openWindow(ctx, c.Session, repoRoot, opts.Prompt, false); err != nil {
+				startErrs = append(startErrs, err)
+			}
+			continue
+		}
+		pid, err := a.startBackground(ctx, c.Session, repoRoot, opts.Prompt)
+		if err != nil {
+			startErrs = append(startErrs, err)
+			continue
+		}
+		a.printBackground(c.Session, pid)
+	}
+	if !background {
+		_, _ = fmt.Fprintf(a.Stdout, "Attach with: wt attach %s\n", creations[0].Session.Name)
+	}
+	return errors.Join(startErrs...)
+}
+
+// printSession prints where a new session lives and what it started from
+func (a *App) printSession(sess *session.Session) {
+	_, _ = fmt.Fprintf(a.Stdout, "  Branch: %s\n", sess.Branch)
+	_, _ = fmt.Fprintf(a.Stdout, "  Base: %s\n", describeBase(sess.Meta))
+	_, _ = fmt.Fprintf(a.Stdout, "  Path: %s\n", sess.Path)
+}
+
+// describeBase summarizes where a session branch came from
+func describeBase(meta session.Metadata) string {
+	if meta.BaseRef == "" {
+		return "existing branch"
+	}
+	desc := meta.BaseRef
+	if len(meta.BaseCommit) >= 7 {
+		desc += " @ " + meta.BaseCommit[:7]
+	}
+	if meta.BaseMode == session.BaseLocal {
+		desc += " (local branch)"
+	}
+	return desc
+}
+
+// readPrompt returns the instruction given with --prompt or --prompt-file,
+// if any
+func (a *App) readPrompt(prompt, promptFile string) (string, error) {
+	if prompt != "" && promptFile != "" {
+		return "", fmt.Errorf("--prompt and --prompt-file can't be used together")
+	}
+	if promptFile != "" {
+		var data []byte
+		var err error
+		if promptFile == "-" {
+			data, err = io.ReadAll(a.Stdin)
+		} else {
+			data, err = os.ReadFile(promptFile)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt: %w", err)
+		}
+		prompt = string(data)
+		if strings.TrimSpace(prompt) == "" {
+			return "", fmt.Errorf("prompt file %s is empty", promptFile)
+		}
+	}
+	return strings.TrimSpace(prompt), nil
+}
+
+// launchClaude launches Claude Code in a session's worktree and waits for it
+func (a *App) launchClaude(ctx context.Context, sess *session.Session, repoRoot string, continueConversation bool) error {
+	lock, err := a.claimAgent(ctx, sess)
+	if err != nil {
+		return err
+	}
+	if err := a.Sessions.ClearRun(sess.Path); err != nil {
+		_ = lock.Close()
+		return err
+	}
+	agent := a.agentCommand(ctx, sess, repoRoot, "", continueConversation)
+	agent.ExtraFiles = []*os.File{lock}
+	err = agent.Start()
+	_ = lock.Close()
+	if err != nil {
+		return fmt.Errorf("failed to launch Claude Code: %w", err)
+	}
+	return a.waitAgent(sess.Path, agent)
+}
+
+// waitAgent waits for an agent started in worktreePath, recording its PID
+// and exit status so that other wt commands know whether it's running
+func (a *App) waitAgent(worktreePath string, agent *exec.Cmd) error {
+	if err := a.Sessions.RecordStart(worktreePath, agent.Process.Pid); err != nil {
+		_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", err)
+	}
+
+	err := agent.Wait()
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	}
+	// A negative code means the agent was killed by a signal, which RunStatus
+	// reports as such when no exit status is recorded
+	if code >= 0 && (err == nil || exitErr != nil) {
+		if recErr := a.Sessions.RecordExit(worktreePath, code); recErr != nil {
+			_, _ = fmt.Fprintf(a.Stderr, "Warning: %v\n", recErr)
+		}
+	}
+	return err
+}
+
+// agentCommand returns the command that runs Claude Code in a session's
+// worktree, starting it on prompt if that's not empty
+func (a *App) agentCommand(ctx context.Context, sess *session.Session, repoRoot, prompt string, continueConversation bool) *exec.Cmd {
+	claudeArgs := claudeCommand(sess.Path, repoRoot, continueConversation) + promptArg(prompt)
+
+	_, _ = fmt.Fprintf(a.Stdout, "Launching Claude Code in %s...\n", sess.Path)
+
+	// Use shell to run claude so that aliases work. Deliberately not bound to
+	// a context: the agent gets Ctrl-C straight from the terminal and decides
+	// what it means, while wt waits for it to exit.
+	cmd := exec.Command(userShell(), "-i", "-c", claudeArgs)
+	cmd.Dir = sess.Path
+	cmd.Stdin = a.Stdin
+	cmd.Stdout = a.Stdout
+	cmd.Stderr = a.Stderr
+	cmd.Env = append(os.Environ(), a.sessionEnv(ctx, sess)...)
+
+	return cmd
+}
+
+// claudeCommand returns the shell command line that starts Claude Code in
+// worktreePath, without a prompt
+func claudeCommand(worktreePath, repoRoot string, continueConversation bool) string {
 	claudeArgs := "claude"
 
 	if continueConversation {
@@ -64,22 +470,29 @@ func launchClaude(worktreePath, repoRoot string, continueConversation bool) erro
 
 	// Add original repository as additional context
 	if repoRoot != "" && repoRoot != worktreePath {
-		claudeArgs += fmt.Sprintf(" --add-dir %q", repoRoot)
+		claudeArgs += " --add-dir " + shellQuote(repoRoot)
 	}
+	return claudeArgs
+}
 
-	fmt.Printf("Launching Claude Code in %s...\n", worktreePath)
-
-	// Use shell to run claude so that aliases work
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+// promptArg returns the arguments that pass prompt to Claude Code, which
+// takes it as its last argument
+func promptArg(prompt string) string {
+	if prompt == "" {
+		return ""
 	}
+	return " -- " + shellQuote(prompt)
+}
 
-	cmd := exec.Command(shell, "-i", "-c", claudeArgs)
-	cmd.Dir = worktreePath
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// userShell returns the user's shell, falling back to bash
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/bash"
+}
 
-	return cmd.Run()
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
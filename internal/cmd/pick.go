@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/emilrex/wt/internal/session"
+	"github.com/emilrex/wt/internal/term"
+)
+
+// ErrNameRequired is returned when a command needs a session and none was
+// given, nor can one be picked interactively
+var ErrNameRequired = errors.New("session name required")
+
+// errNoSelection is returned when the user closes the picker without
+// choosing a session
+var errNoSelection = errors.New("no session selected")
+
+// PickSession asks the user to choose one of the repository's sessions for
+// command, e.g. "fg". Without a terminal to ask on, it prints the sessions
+// and returns ErrNameRequired.
+func (a *App) PickSession(ctx context.Context, command string) (string, error) {
+	sessions, err := a.Sessions.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	interactive := term.IsTerminal(a.Stdin) && term.IsTerminal(a.Stderr)
+	if len(sessions) == 0 {
+		if !interactive {
+			return "", ErrNameRequired
+		}
+		return "", fmt.Errorf("%w: no active sessions", session.ErrNotFound)
+	}
+	header, lines := a.pickerLines(ctx, sessions)
+
+	if !interactive {
+		_, _ = fmt.Fprintf(a.Stderr, "Choose a session with: wt %s <session-name>\n\n", command)
+		_, _ = fmt.Fprintln(a.Stderr, header)
+		for _, line := range lines {
+			_, _ = fmt.Fprintln(a.Stderr, line)
+		}
+		_, _ = fmt.Fprintln(a.Stderr)
+		return "", ErrNameRequired
+	}
+
+	var i int
+	if a.Config.Picker == "fzf" {
+		i, err = a.pickFzf(ctx, command, header, lines)
+	} else {
+		i, err = a.pickBuiltin(command, header, lines)
+	}
+	if err != nil {
+		return "", err
+	}
+	return sessions[i].Name, nil
+}
+
+// pickerLines describes each session on one line, in columns under header
+func (a *App) pickerLines(ctx context.Context, sessions []session.Session) (header string, lines []string) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "Session\tBranch\tAgent\tChanges\tActive")
+	now := time.Now()
+	for _, s := range sessions {
+		agent, _ := a.agentState(ctx, &s)
+		changes := "-"
+		if dirty, err := a.Git.HasChanges(ctx, s.Path); err == nil {
+			changes = "clean"
+			if dirty {
+				changes = "dirty"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Branch, agent, changes, ago(a.Sessions.LastActivity(&s), now))
+	}
+	_ = w.Flush()
+
+	all := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	// tabwriter pads the last column too; trailing spaces would only get in
+	// the way of matching
+	for i := range all {
+		all[i] = strings.TrimRightFunc(all[i], unicode.IsSpace)
+	}
+	return all[0], all[1:]
+}
+
+// pickFzf lets fzf do the choosing
+func (a *App) pickFzf(ctx context.Context, command, header string, lines []string) (int, error) {
+	if _, err := exec.LookPath("fzf"); err != nil {
+		return 0, fmt.Errorf("wt.picker is fzf, but fzf is not installed: %w", err)
+	}
+	// Each line is prefixed with its index so the choice maps back to a
+	// session however fzf trims it
+	var input strings.Builder
+	input.WriteString("-\t" + header + "\n")
+	for i, line := range lines {
+		fmt.Fprintf(&input, "%d\t%s\n", i, line)
+	}
+
+	cmd := exec.CommandContext(ctx, "fzf",
+		"--header-lines=1", "--delimiter=\t", "--with-nth=2..",
+		"--height=40%", "--reverse", "--prompt=wt "+command+"> ")
+	cmd.Stdin = strings.NewReader(input.String())
+	cmd.Stderr = a.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// fzf exits 1 when nothing matched and 130 when cancelled
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+			return 0, errNoSelection
+		}
+		return 0, fmt.Errorf("fzf failed: %w", err)
+	}
+
+	var i int
+	if _, err := fmt.Sscan(string(out), &i); err != nil || i < 0 || i >= len(lines) {
+		return 0, fmt.Errorf("unexpected fzf output %q", out)
+	}
+	return i, nil
+}
+
+// picker is the state of the built-in picker
+type picker struct {
+	prompt  string
+	header  string
+	lines   []string
+	query   string
+	matches []int
+	// selected indexes matches
+	selected int
+}
+
+// filter recomputes the lines matching the query, keeping their order
+func (p *picker) filter() {
+	p.matches = p.matches[:0]
+	for i, line := range p.lines {
+		if session.FuzzyMatch(p.query, line) {
+			p.matches = append(p.matches, i)
+		}
+	}
+	p.selected = min(p.selected, max(len(p.matches)-1, 0))
+}
+
+// pickBuiltin shows the built-in picker on the terminal and returns the
+// index of the chosen line
+func (a *App) pickBuiltin(command, header string, lines []string) (int, error) {
+	in := a.Stdin.(*os.File)
+	restore, err := term.Cbreak(in)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = fmt.Fprint(a.Stderr, altScreenOn)
+	defer func() {
+		_, _ = fmt.Fprint(a.Stderr, altScreenOff)
+		restore()
+	}()
+
+	p := &picker{prompt: "wt " + command + "> ", header: header, lines: lines}
+	p.filter()
+	buf := make([]byte, 256)
+	for {
+		width, height := term.Size(in)
+		_, _ = fmt.Fprint(a.Stderr, p.render(width, height))
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range term.ParseKeys(buf[:n]) {
+			if i, done, err := p.handle(key); done {
+				return i, err
+			}
+		}
+	}
+}
+
+// handle acts on a keypress. Once done, it returns the chosen line or
+// errNoSelection.
+func (p *picker) handle(key term.Key) (i int, done bool, err error) {
+	switch key {
+	case term.KeyEsc, term.KeyCtrlC:
+		return 0, true, errNoSelection
+	case term.KeyEnter:
+		if len(p.matches) == 0 {
+			return 0, false, nil
+		}
+		return p.matches[p.selected], true, nil
+	case term.KeyUp:
+		p.selected = max(p.selected-1, 0)
+	case term.KeyDown:
+		p.selected = min(p.selected+1, max(len(p.matches)-1, 0))
+	case term.KeyBackspace:
+		if q := []rune(p.query); len(q) > 0 {
+			p.query = string(q[:len(q)-1])
+			p.filter()
+		}
+	default:
+		if r := []rune(string(key)); len(r) == 1 && unicode.IsPrint(r[0]) {
+			p.query += string(key)
+			p.selected = 0
+			p.filter()
+		}
+	}
+	return 0, false, nil
+}
+
+// render draws the picker: the query on top, then the matching sessions
+func (p *picker) render(width, height int) string {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	lines := []string{
+		truncate(p.prompt+p.query, width),
+		truncate(fmt.Sprintf("  %d/%d  ↑/↓ select  enter choose  esc cancel", len(p.matches), len(p.lines)), width),
+		truncate("  "+p.header, width),
+	}
+	// Scroll so the selection stays on screen
+	room := max(height-len(lines), 1)
+	first := max(p.selected-room+1, 0)
+	for j := first; j < len(p.matches) && j < first+room; j++ {
+		line := "  " + p.lines[p.matches[j]]
+		if j == p.selected {
+			line = reverseVideo + truncate("> "+p.lines[p.matches[j]], width) + resetStyle
+		} else {
+			line = truncate(line, width)
+		}
+		lines = append(lines, line)
+	}
+	b.WriteString(strings.Join(lines, "\n"))
+	return b.String()
+}
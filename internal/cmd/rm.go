@@ -1,27 +1,75 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/emilrex/wt/internal/session"
+	"github.com/emilrex/wt/internal/term"
 )
 
 // RmOptions contains options for the rm command
 type RmOptions struct {
 	SessionName string
 	All         bool
+	// Force removes sessions even if they have unpushed submodule commits or
+	// a running agent
+	Force bool
 }
 
 // RunRm removes one or more sessions
-func RunRm(opts RmOptions) error {
+func (a *App) RunRm(ctx context.Context, opts RmOptions) error {
 	if opts.All {
-		fmt.Println("Removing all sessions...")
-		return session.RemoveAll()
+		// Remember the sessions to close the windows of those removed
+		sessions, err := a.Sessions.List(ctx)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(a.Stdout, "Removing all sessions...")
+		err = a.Sessions.RemoveAll(ctx, opts.Force)
+		a.killWindows(ctx, sessions)
+		return err
 	}
 
 	if opts.SessionName == "" {
 		return fmt.Errorf("session name required (or use --all)")
 	}
 
-	return session.Remove(opts.SessionName)
+	sess, err := a.Sessions.FindStrict(ctx, opts.SessionName)
+	var loose *session.LooseMatchError
+	if errors.As(err, &loose) {
+		if !a.confirm(fmt.Sprintf("'%s' only loosely matches session '%s'. Remove it? [y/N] ", loose.Query, loose.Session.Name)) {
+			return err
+		}
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return a.removeSession(ctx, sess, opts.Force)
+}
+
+// removeSession removes sess, which the user named exactly or confirmed,
+// and closes its multiplexer window
+func (a *App) removeSession(ctx context.Context, sess *session.Session, force bool) error {
+	if err := a.Sessions.Remove(ctx, sess.Name, force); err != nil {
+		return err
+	}
+	a.killWindows(ctx, []session.Session{*sess})
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal; without one, the answer
+// is no
+func (a *App) confirm(question string) bool {
+	if !term.IsTerminal(a.Stdin) || !term.IsTerminal(a.Stderr) {
+		return false
+	}
+	_, _ = fmt.Fprint(a.Stderr, question)
+	answer, _ := bufio.NewReader(a.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
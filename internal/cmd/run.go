@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/emilrex/wt/internal/proc"
+	"github.com/emilrex/wt/internal/session"
+)
+
+// errNoPrompt is returned for a background run without an instruction
+var errNoPrompt = errors.New("a background run needs a prompt (--prompt or --prompt-file)")
+
+// RunOptions contains options for the run command
+type RunOptions struct {
+	SessionName string
+	// Prompt replaces the instruction the session was created with (--prompt)
+	Prompt string
+	// PromptFile holds the new instruction, or "-" for stdin (--prompt-file)
+	PromptFile string
+}
+
+// RunRun starts Claude Code headless in the background in an existing
+// session, on the given prompt or else the one the session was created with
+func (a *App) RunRun(ctx context.Context, opts RunOptions) error {
+	sess, err := a.Sessions.Find(ctx, opts.SessionName)
+	if err != nil {
+		return err
+	}
+
+	prompt, err := a.readPrompt(opts.Prompt, opts.PromptFile)
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		prompt = sess.Meta.Prompt
+	} else {
+		// Record the new task, so ls shows what the session is doing now
+		sess.Meta.Prompt = prompt
+		if err := a.Sessions.SaveMetadata(sess.Path, sess.Meta); err != nil {
+			return err
+		}
+	}
+	if prompt == "" {
+		return errNoPrompt
+	}
+
+	repoRoot, err := a.Git.GetRepoRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	pid, err := a.startBackground(ctx, sess, repoRoot, prompt)
+	if err != nil {
+		return err
+	}
+	a.printBackground(sess, pid)
+	return nil
+}
+
+// startBackground starts Claude Code headless on prompt, detached from the
+// terminal so it outlives wt. Its output goes to the session's log file; its
+// PID and, once it finishes, its exit status are recorded next to it.
+func (a *App) startBackground(ctx context.Context, sess *session.Session, repoRoot, prompt string) (int, error) {
+	lock, err := a.claimAgent(ctx, sess)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Close() }()
+
+	if err := a.Sessions.ClearRun(sess.Path); err != nil {
+		return 0, err
+	}
+	files := a.Sessions.RunFiles(sess.Path)
+	log, err := os.Create(files.Log)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create agent log: %w", err)
+	}
+	defer func() { _ = log.Close() }()
+
+	// A plain sh rather than the user's interactive shell, which would want
+	// a terminal; it stays around to record the agent's exit status
+	script := claudeCommand(sess.Path, repoRoot, false) + " --print" + promptArg(prompt) +
+		"; echo $? > " + shellQuote(files.Exit)
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Dir = sess.Path
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.Env = append(os.Environ(), a.sessionEnv(ctx, sess)...)
+	cmd.ExtraFiles = []*os.File{lock}
+	proc.Detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch Claude Code: %w", err)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+
+	if err := a.Sessions.RecordStart(sess.Path, pid); err != nil {
+		_ = proc.Terminate(pid)
+		return 0, err
+	}
+	return pid, nil
+}
+
+// claimAgent takes the agent lock of sess before an agent starts there. It
+// fails with ErrAgentRunning if another agent is running in the session:
+// one holding the lock, or one in the session's multiplexer window. The
+// caller hands the lock to the agent, which holds it until it exits, or
+// else closes it.
+func (a *App) claimAgent(ctx context.Context, sess *session.Session) (*os.File, error) {
+	lock, err := a.Sessions.LockAgent(sess.Path)
+	if err != nil {
+		return nil, fmt.Errorf("session '%s': %w", sess.Name, err)
+	}
+	if a.Mux != nil && a.Mux.Alive(ctx, windowName(sess)) {
+		_ = lock.Close()
+		return nil, fmt.Errorf("session '%s': %w in %s window %s", sess.Name, session.ErrAgentRunning, a.Config.Mux, windowName(sess))
+	}
+	return lock, nil
+}
+
+// printBackground tells the user where a background agent's output goes
+func (a *App) printBackground(sess *session.Session, pid int) {
+	_, _ = fmt.Fprintf(a.Stdout, "Agent running in the background in '%s' (pid %d)\n", sess.Name, pid)
+	_, _ = fmt.Fprintf(a.Stdout, "  Follow its output with: wt logs %s -f\n", sess.Name)
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emilrex/wt/internal/session"
+)
+
+// sessionDetails is everything wt show reports about a session. Fields that
+// couldn't be determined are left empty.
+type sessionDetails struct {
+	Name         string           `json:"name"`
+	Branch       string           `json:"branch"`
+	Path         string           `json:"path"`
+	SourceBranch string           `json:"source_branch,omitempty"`
+	BaseRef      string           `json:"base_ref,omitempty"`
+	BaseMode     session.BaseMode `json:"base_mode,omitempty"`
+	BaseCommit   string           `json:"base_commit,omitempty"`
+	CreatedAt    time.Time        `json:"created_at,omitzero"`
+	ResumedAt    time.Time        `json:"resumed_at,omitzero"`
+	LastActivity time.Time        `json:"last_activity,omitzero"`
+	Agent        string           `json:"agent"`
+	// AgentState is running, idle, exited(code) or killed
+	AgentState string   `json:"agent_state"`
+	AgentPID   int      `json:"agent_pid,omitempty"`
+	Prompt     string   `json:"prompt,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Sparse     []string `json:"sparse,omitempty"`
+	// Ports is the session's block of ports, as first-last
+	Ports       string `json:"ports,omitempty"`
+	HeadCommit  string `json:"head_commit,omitempty"`
+	HeadSubject string `json:"head_subject,omitempty"`
+	// Ahead and Behind compare the branch with CompareRef
+	CompareRef string `json:"compare_ref,omitempty"`
+	Ahead      *int   `json:"ahead,omitempty"`
+	Behind     *int   `json:"behind,omitempty"`
+	Dirty      *bool  `json:"dirty,omitempty"`
+	DiskUsage  int64  `json:"disk_usage_bytes"`
+}
+
+// RunShow prints everything known about a session, as text or JSON
+func (a *App) RunShow(ctx context.Context, sessionName string, asJSON bool) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+
+	d := a.sessionDetails(ctx, sess)
+	d.DiskUsage = session.DiskUsage(sess.Path)
+	if asJSON {
+		enc := json.NewEncoder(a.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	return a.printDetails(d)
+}
+
+// sessionDetails gathers what git and wt's state files know about sess,
+// except its disk usage, which takes a walk of the worktree. Anything that
+// can't be read is left out rather than failing the command.
+func (a *App) sessionDetails(ctx context.Context, sess *session.Session) sessionDetails {
+	meta := sess.Meta
+	d := sessionDetails{
+		Name:         sess.Name,
+		Branch:       sess.Branch,
+		Path:         sess.Path,
+		SourceBranch: meta.SourceBranch,
+		BaseRef:      meta.BaseRef,
+		BaseMode:     meta.BaseMode,
+		BaseCommit:   meta.BaseCommit,
+		CreatedAt:    meta.CreatedAt,
+		ResumedAt:    meta.ResumedAt,
+		Agent:        "claude",
+		Prompt:       meta.Prompt,
+		Tags:         meta.Tags,
+		Sparse:       meta.Sparse,
+	}
+
+	if ports, ok := a.Sessions.AssignedPorts(sess.Path); ok {
+		d.Ports = ports.String()
+	}
+
+	d.AgentState, _ = a.agentState(ctx, sess)
+	if status, err := a.Sessions.RunStatus(sess.Path); err == nil && status.Running {
+		d.AgentPID = status.PID
+	}
+
+	d.HeadCommit, d.HeadSubject, _ = a.Git.HeadCommit(ctx, sess.Path)
+
+	// Compare with what the session started from, or failing that its source
+	d.CompareRef = meta.BaseRef
+	if d.CompareRef == "" {
+		d.CompareRef = meta.SourceBranch
+	}
+	if d.CompareRef != "" {
+		if ahead, behind, err := a.Git.AheadBehind(ctx, d.CompareRef, sess.Branch); err == nil {
+			d.Ahead, d.Behind = &ahead, &behind
+		} else {
+			d.CompareRef = ""
+		}
+	}
+
+	if dirty, err := a.Git.HasChanges(ctx, sess.Path); err == nil {
+		d.Dirty = &dirty
+	}
+	d.LastActivity = a.Sessions.LastActivity(sess)
+	return d
+}
+
+// printDetails prints d as aligned "Label: value" lines
+func (a *App) printDetails(d sessionDetails) error {
+	w := tabwriter.NewWriter(a.Stdout, 0, 0, 2, ' ', 0)
+	line := func(label, format string, args ...any) {
+		_, _ = fmt.Fprintf(w, "%s:\t"+format+"\n", append([]any{label}, args...)...)
+	}
+
+	line("Session", "%s", d.Name)
+	line("Branch", "%s", d.Branch)
+	line("Path", "%s", d.Path)
+	if d.SourceBranch != "" {
+		line("Source", "%s", d.SourceBranch)
+	}
+	line("Base", "%s", describeBase(session.Metadata{BaseRef: d.BaseRef, BaseMode: d.BaseMode, BaseCommit: d.BaseCommit}))
+	if len(d.Tags) > 0 {
+		line("Tags", "%s", strings.Join(d.Tags, ", "))
+	}
+	if len(d.Sparse) > 0 {
+		line("Sparse", "%s", strings.Join(d.Sparse, ", "))
+	}
+	if d.Ports != "" {
+		line("Ports", "%s", d.Ports)
+	}
+	line("Created", "%s", describeTime(d.CreatedAt))
+	line("Resumed", "%s", describeTime(d.ResumedAt))
+	line("Active", "%s", describeTime(d.LastActivity))
+	agent := d.Agent + " (" + d.AgentState
+	if d.AgentPID != 0 {
+		agent += fmt.Sprintf(", pid %d", d.AgentPID)
+	}
+	line("Agent", "%s)", agent)
+	if d.HeadCommit != "" {
+		line("HEAD", "%s %s", shortHash(d.HeadCommit), d.HeadSubject)
+	}
+	if d.Ahead != nil {
+		line("Commits", "%d ahead, %d behind %s", *d.Ahead, *d.Behind, d.CompareRef)
+	}
+	if d.Dirty != nil {
+		changes := "none"
+		if *d.Dirty {
+			changes = "uncommitted changes"
+		}
+		line("Changes", "%s", changes)
+	}
+	line("Disk", "%s", formatBytes(d.DiskUsage))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if d.Prompt != "" {
+		_, _ = fmt.Fprintln(a.Stdout, "Prompt:")
+		for _, l := range strings.Split(d.Prompt, "\n") {
+			_, _ = fmt.Fprintf(a.Stdout, "  %s\n", l)
+		}
+	}
+	return nil
+}
+
+// describeTime formats t with how long ago it was, or "never"
+func describeTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Local().Format("2006-01-02 15:04"), time.Since(t).Round(time.Second))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// formatBytes formats n bytes in the largest unit that keeps it above 1
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RunSparseAdd widens a sparse session's checkout to include more
+// directories
+func (a *App) RunSparseAdd(ctx context.Context, sessionName string, paths []string) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+	if err := a.Sessions.SparseAdd(ctx, sess, paths); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(a.Stdout, "Session '%s' now checks out %s\n", sess.Name, strings.Join(sess.Meta.Sparse, ", "))
+	return nil
+}
+
+// RunSparseList prints the directories checked out in a session, one per
+// line, as git reports them
+func (a *App) RunSparseList(ctx context.Context, sessionName string) error {
+	sess, err := a.Sessions.Find(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+	paths, sparse, err := a.Git.SparsePaths(ctx, sess.Path)
+	if err != nil {
+		return err
+	}
+	if !sparse {
+		_, _ = fmt.Fprintf(a.Stderr, "Session '%s' has a full checkout\n", sess.Name)
+		return nil
+	}
+	for _, p := range paths {
+		_, _ = fmt.Fprintln(a.Stdout, p)
+	}
+	return nil
+}
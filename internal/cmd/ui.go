@@ -0,0 +1,490 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emilrex/wt/internal/session"
+	"github.com/emilrex/wt/internal/term"
+)
+
+// uiRefreshInterval is how often wt ui polls sessions for changes
+const uiRefreshInterval = 2 * time.Second
+
+// uiRecheckInterval is how long wt ui trusts what git said about a session
+// whose files haven't changed, as its base ref may still move on or its
+// agent die
+const uiRecheckInterval = 30 * time.Second
+
+// ANSI escape sequences used by the dashboard
+const (
+	altScreenOn  = "\x1b[?1049h"
+	altScreenOff = "\x1b[?1049l"
+	cursorHide   = "\x1b[?25l"
+	cursorShow   = "\x1b[?25h"
+	clearScreen  = "\x1b[H\x1b[2J"
+	reverseVideo = "\x1b[7m"
+	resetStyle   = "\x1b[0m"
+)
+
+const uiHelp = "↑/↓ select  enter resume  s shell  d diff  m merge  r remove  R force remove  q quit"
+
+// dashboardRow is one session as shown by wt ui
+type dashboardRow struct {
+	sess    session.Session
+	details sessionDetails
+}
+
+// dashboard is the state of a running wt ui
+type dashboard struct {
+	a       *App
+	in      *os.File
+	restore func()
+
+	rows     []dashboardRow
+	selected int
+	message  string
+	// confirm runs once the user answers y to message
+	confirm func(ctx context.Context)
+
+	// Polls run in the background so that keys are handled meanwhile, one
+	// at a time; repoll asks for another once the running one is done, as
+	// it may have missed an action's effects
+	poller  *dashboardPoller
+	polls   chan dashboardPoll
+	polling bool
+	repoll  bool
+}
+
+// dashboardPoll is the outcome of a poll of the sessions
+type dashboardPoll struct {
+	rows []dashboardRow
+	err  error
+}
+
+// RunUI shows a dashboard of all sessions that refreshes itself, with keys
+// to resume, open a shell in, diff, merge and remove the selected session
+func (a *App) RunUI(ctx context.Context) error {
+	in, ok := a.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(in) {
+		return errors.New("wt ui needs a terminal")
+	}
+
+	d := &dashboard{a: a, in: in, poller: newDashboardPoller(a), polls: make(chan dashboardPoll, 1)}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	return d.run(ctx)
+}
+
+// enter switches the terminal to the dashboard
+func (d *dashboard) enter() error {
+	restore, err := term.Cbreak(d.in)
+	if err != nil {
+		return err
+	}
+	d.restore = restore
+	_, _ = fmt.Fprint(d.a.Stdout, altScreenOn+cursorHide)
+	return nil
+}
+
+// leave gives the terminal back as it was
+func (d *dashboard) leave() {
+	_, _ = fmt.Fprint(d.a.Stdout, cursorShow+altScreenOff)
+	d.restore()
+}
+
+func (d *dashboard) run(ctx context.Context) error {
+	d.update(d.poller.poll(ctx))
+	d.draw()
+
+	keys := term.NewKeyReader(d.in)
+	keys.Request()
+	ticker := time.NewTicker(uiRefreshInterval)
+	defer ticker.Stop()
+
+	done := ctx.Done()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if !d.polling {
+				d.poll(ctx)
+			}
+		case res := <-d.polls:
+			d.polling = false
+			d.update(res.rows, res.err)
+			d.draw()
+			if d.repoll {
+				d.repoll = false
+				d.poll(ctx)
+			}
+		case key, ok := <-keys.Keys():
+			if !ok {
+				return nil
+			}
+			if d.handle(ctx, key) {
+				return nil
+			}
+			// Ctrl-C in a resumed agent also reaches wt; that is no
+			// reason to close the dashboard
+			if ctx.Err() != nil {
+				ctx, done = context.WithoutCancel(ctx), nil
+			}
+			d.poll(ctx)
+			d.draw()
+			keys.Request()
+		}
+	}
+}
+
+// handle acts on a keypress and reports whether to quit
+func (d *dashboard) handle(ctx context.Context, key term.Key) (quit bool) {
+	// Actions started from the dashboard finish even if wt is interrupted
+	actx := context.WithoutCancel(ctx)
+
+	if confirm := d.confirm; confirm != nil {
+		d.confirm = nil
+		d.message = "Cancelled"
+		if key == "y" || key == "Y" {
+			d.message = ""
+			confirm(actx)
+		}
+		return false
+	}
+	d.message = ""
+
+	switch key {
+	case "q", term.KeyEsc, term.KeyCtrlC:
+		return true
+	case term.KeyUp, "k":
+		d.selected = max(d.selected-1, 0)
+		return false
+	case term.KeyDown, "j":
+		d.selected = min(d.selected+1, max(len(d.rows)-1, 0))
+		return false
+	}
+
+	if len(d.rows) == 0 {
+		return false
+	}
+	row := d.rows[d.selected]
+	name := row.sess.Name
+
+	switch key {
+	case term.KeyEnter, "f":
+		d.suspend(func() error { return d.a.RunFg(actx, name) })
+	case "s":
+		d.suspend(func() error { return d.a.RunCd(actx, name) })
+	case "d":
+		d.diff(actx, row)
+	case "m":
+		d.ask(fmt.Sprintf("Merge %s into %s? [y/N]", row.sess.Branch, row.sess.Meta.SourceBranch), func(ctx context.Context) {
+			d.merge(ctx, row)
+		})
+	case "r", "R":
+		force := key == "R"
+		prompt := fmt.Sprintf("Remove session '%s'? [y/N]", name)
+		if force {
+			prompt = fmt.Sprintf("Remove session '%s', even with a running agent or unpushed submodule commits? [y/N]", name)
+		}
+		d.ask(prompt, func(ctx context.Context) {
+			d.remove(ctx, name, force)
+		})
+	}
+	return false
+}
+
+// ask shows prompt and runs fn if the next key is y
+func (d *dashboard) ask(prompt string, fn func(ctx context.Context)) {
+	d.message = prompt
+	d.confirm = fn
+}
+
+// suspend gives the terminal to fn, e.g. to run the agent, and takes it
+// back afterwards
+func (d *dashboard) suspend(fn func() error) {
+	d.leave()
+	err := fn()
+	if enterErr := d.enter(); enterErr != nil {
+		err = errors.Join(err, enterErr)
+	}
+	if err != nil {
+		d.message = "Error: " + err.Error()
+	}
+}
+
+// diff pages through the session's changes since it forked from its base,
+// including uncommitted ones. Commits that reached the base since then
+// aren't the session's, so it diffs against the merge base rather than the
+// base ref, which moves on.
+func (d *dashboard) diff(ctx context.Context, row dashboardRow) {
+	base, label := d.forkPoint(ctx, row)
+	if exec.CommandContext(ctx, "git", "-C", row.sess.Path, "diff", "--quiet", base).Run() == nil {
+		d.message = fmt.Sprintf("No changes since %s", label)
+		return
+	}
+	d.suspend(func() error {
+		cmd := exec.CommandContext(ctx, "git", "-C", row.sess.Path, "diff", base)
+		cmd.Stdin = d.in
+		cmd.Stdout = d.a.Stdout
+		cmd.Stderr = d.a.Stderr
+		return cmd.Run()
+	})
+}
+
+// forkPoint returns the commit a session's changes are diffed against, and
+// how to describe it: the merge base of its branch and CompareRef, else the
+// commit it was created from, else HEAD
+func (d *dashboard) forkPoint(ctx context.Context, row dashboardRow) (commit, label string) {
+	if ref := row.details.CompareRef; ref != "" {
+		if mb, err := d.a.Git.MergeBase(ctx, ref, row.sess.Branch); err == nil {
+			return mb, fmt.Sprintf("%s (merge base with %s)", shortHash(mb), ref)
+		}
+	}
+	if c := row.sess.Meta.BaseCommit; c != "" {
+		return c, shortHash(c)
+	}
+	return "HEAD", "HEAD"
+}
+
+// merge merges the session branch into its source branch, which must be
+// checked out in the main repository
+func (d *dashboard) merge(ctx context.Context, row dashboardRow) {
+	source := row.sess.Meta.SourceBranch
+	if source == "" {
+		d.message = fmt.Sprintf("Don't know which branch '%s' came from", row.sess.Name)
+		return
+	}
+	root, err := d.a.Git.GetRepoRoot(ctx)
+	if err != nil {
+		d.message = "Error: " + err.Error()
+		return
+	}
+	if current, err := d.a.Git.GetBranchAt(ctx, root); err != nil || current != source {
+		d.message = fmt.Sprintf("Check out %s in %s to merge into it", source, root)
+		return
+	}
+	if err := d.a.Git.Merge(ctx, root, row.sess.Branch); err != nil {
+		d.message = "Error: " + err.Error()
+		return
+	}
+	d.message = fmt.Sprintf("Merged %s into %s", row.sess.Branch, source)
+}
+
+// remove removes a session, offering to force it if it has changes. The
+// name comes from the session list, so it must match exactly; one that
+// has gone away since is never mistaken for another.
+func (d *dashboard) remove(ctx context.Context, name string, force bool) {
+	sess, err := d.a.Sessions.FindStrict(ctx, name)
+	if err == nil && sess.Name != name {
+		err = fmt.Errorf("%w: '%s'", session.ErrNotFound, name)
+	}
+	var warnings []string
+	if err == nil {
+		warnings, err = d.quietly(func() error { return d.a.removeSession(ctx, sess, force) })
+	}
+	switch {
+	case errors.Is(err, session.ErrUnpushedSubmodule):
+		d.message = fmt.Sprintf("'%s' has unpushed submodule commits; press R to remove it anyway", name)
+	case err != nil:
+		d.message = "Error: " + err.Error()
+	default:
+		d.message = fmt.Sprintf("Removed '%s'", name)
+	}
+	if len(warnings) > 0 {
+		d.message += " (" + strings.Join(warnings, "; ") + ")"
+	}
+}
+
+// quietly runs fn with the progress messages and warnings that commands
+// print collected instead of written over the dashboard, and returns the
+// warnings, for the status line
+func (d *dashboard) quietly(fn func() error) (warnings []string, err error) {
+	var out bytes.Buffer
+	sessionsOut, stderr := d.a.Sessions.Out, d.a.Stderr
+	d.a.Sessions.Out, d.a.Stderr = &out, &out
+	defer func() { d.a.Sessions.Out, d.a.Stderr = sessionsOut, stderr }()
+
+	err = fn()
+	for line := range strings.Lines(out.String()) {
+		if w, ok := strings.CutPrefix(strings.TrimSpace(line), "Warning: "); ok {
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings, err
+}
+
+// poll starts a poll of the sessions in the background, or if one is
+// running, another after it
+func (d *dashboard) poll(ctx context.Context) {
+	if d.polling {
+		d.repoll = true
+		return
+	}
+	d.polling = true
+	go func() {
+		rows, err := d.poller.poll(ctx)
+		d.polls <- dashboardPoll{rows: rows, err: err}
+	}()
+}
+
+// update shows the rows of a poll, keeping the selection on the same
+// session where possible
+func (d *dashboard) update(rows []dashboardRow, err error) {
+	if err != nil {
+		d.message = "Error: " + err.Error()
+		return
+	}
+	var selectedName string
+	if d.selected < len(d.rows) {
+		selectedName = d.rows[d.selected].sess.Name
+	}
+	d.rows = rows
+
+	d.selected = min(d.selected, max(len(d.rows)-1, 0))
+	for i, row := range d.rows {
+		if row.sess.Name == selectedName {
+			d.selected = i
+		}
+	}
+}
+
+// dashboardPoller gathers the dashboard's rows. Asking git about a session
+// takes several commands, including a status of its whole worktree, so it
+// only does so for sessions whose activity stamp changed since the last
+// poll, or that it hasn't checked for uiRecheckInterval.
+type dashboardPoller struct {
+	// a is a copy of the App that prints nothing, as polls run alongside
+	// the dashboard's actions, which take over its output
+	a      *App
+	polled map[string]polledSession
+}
+
+// polledSession is what a poll learned about a session
+type polledSession struct {
+	stamp   string
+	checked time.Time
+	details sessionDetails
+}
+
+func newDashboardPoller(a *App) *dashboardPoller {
+	sessions := *a.Sessions
+	sessions.Out = io.Discard
+	quiet := *a
+	quiet.Sessions, quiet.Stdout, quiet.Stderr = &sessions, io.Discard, io.Discard
+	return &dashboardPoller{a: &quiet, polled: make(map[string]polledSession)}
+}
+
+// poll lists the sessions with their details
+func (p *dashboardPoller) poll(ctx context.Context) ([]dashboardRow, error) {
+	sessions, err := p.a.Sessions.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	polled := make(map[string]polledSession, len(sessions))
+	rows := make([]dashboardRow, 0, len(sessions))
+	for _, s := range sessions {
+		stamp := p.a.Sessions.ActivityStamp(&s)
+		prev, ok := p.polled[s.Path]
+		if !ok || prev.stamp != stamp || now.Sub(prev.checked) >= uiRecheckInterval {
+			prev = polledSession{stamp: stamp, checked: now, details: p.a.sessionDetails(ctx, &s)}
+		}
+		polled[s.Path] = prev
+		rows = append(rows, dashboardRow{sess: s, details: prev.details})
+	}
+	p.polled = polled
+	return rows, nil
+}
+
+func (d *dashboard) draw() {
+	width, height := term.Size(d.in)
+	_, _ = fmt.Fprint(d.a.Stdout, renderDashboard(d.rows, d.selected, width, height, d.message, time.Now()))
+}
+
+// renderDashboard draws the whole screen
+func renderDashboard(rows []dashboardRow, selected, width, height int, message string, now time.Time) string {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	header := fmt.Sprintf("wt ui: %d session(s), refreshed %s", len(rows), now.Format("15:04:05"))
+	lines := []string{truncate(header, width), ""}
+
+	if len(rows) == 0 {
+		lines = append(lines, "No active sessions")
+	} else {
+		var table strings.Builder
+		w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  Session\tBranch\tAgent\tChanges\tCommits\tActive\tTask")
+		for _, row := range rows {
+			d := row.details
+			changes := "-"
+			if d.Dirty != nil {
+				changes = "clean"
+				if *d.Dirty {
+					changes = "dirty"
+				}
+			}
+			commits := "-"
+			if d.Ahead != nil {
+				commits = fmt.Sprintf("+%d -%d", *d.Ahead, *d.Behind)
+			}
+			_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				row.sess.Name, row.sess.Branch, d.AgentState, changes, commits, ago(d.LastActivity, now), summarizePrompt(d.Prompt))
+		}
+		_ = w.Flush()
+
+		for i, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+			line = truncate(line, width)
+			// Line 0 is the header
+			if i-1 == selected {
+				line = reverseVideo + ">" + strings.TrimPrefix(line, " ") + resetStyle
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	// Keep the message and help at the bottom of the screen
+	footer := []string{"", truncate(message, width), truncate(uiHelp, width)}
+	for len(lines)+len(footer) < height {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+	b.WriteString(strings.Join(lines, "\n"))
+	return b.String()
+}
+
+// ago formats how long before now t was, coarsely
+func ago(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	switch d := now.Sub(t); {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// truncate cuts s to at most width runes
+func truncate(s string, width int) string {
+	if runes := []rune(s); len(runes) > width {
+		return string(runes[:width])
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/emilrex/wt/internal/session"
+)
+
+// warmDirs returns the configured warm directories
+func (a *App) warmDirs() ([]session.WarmDir, error) {
+	var dirs []session.WarmDir
+	for _, value := range a.Config.Warm {
+		dir, err := session.ParseWarmDir(value)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// warm clones dirs into the session being created and reports what that
+// took and how much disk it saved
+func (a *App) warm(ctx context.Context, c *session.Creation, dirs []session.WarmDir, out io.Writer) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	results, err := c.Warm(ctx, dirs, out)
+	if err != nil {
+		return err
+	}
+	reportWarm(out, results)
+	return nil
+}
+
+// reportWarm prints how long each clone took and how much disk it saved
+// compared with a copy, which takes up the whole size of the directory again
+func reportWarm(out io.Writer, results []session.WarmResult) {
+	var elapsed time.Duration
+	var size, shared int64
+	for _, r := range results {
+		_, _ = fmt.Fprintf(out, "Cloned %s by %s in %s: %s, ", r.Path, r.Strategy, r.Elapsed.Round(time.Millisecond), formatBytes(r.Size))
+		if r.Shared > 0 {
+			_, _ = fmt.Fprintf(out, "%s shared with the main checkout, saving that much disk over a copy\n", formatBytes(r.Shared))
+		} else {
+			_, _ = fmt.Fprintln(out, "nothing shared with the main checkout")
+		}
+		elapsed += r.Elapsed
+		size += r.Size
+		shared += r.Shared
+	}
+	if len(results) > 1 {
+		_, _ = fmt.Fprintf(out, "Cloned %d directories (%s) in %s, saving %s of disk over copies\n",
+			len(results), formatBytes(size), elapsed.Round(time.Millisecond), formatBytes(shared))
+	}
+}
@@ -0,0 +1,228 @@
+// Package config reads wt settings from git config. Settings live in the
+// wt section, so they can be set for every repository with
+// `git config --global wt.<key> <value>` or for one repository without --global.
+package config
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+)
+
+// Config holds wt settings
+type Config struct {
+	// Base is what new session branches start from: "remote" for the source
+	// branch's remote-tracking ref, "local" to fast-forward and use the local
+	// branch (wt.base)
+	Base string
+	// Fetch updates the source branch from its remote in `wt new` (wt.fetch)
+	Fetch bool
+	// FetchInterval skips the fetch if the source branch was fetched more
+	// recently than this; zero always fetches (wt.fetchInterval)
+	FetchInterval time.Duration
+	// FetchTimeout bounds git commands that talk to a remote (wt.fetchTimeout)
+	FetchTimeout time.Duration
+	// GitTimeout bounds local git commands; zero means no limit (wt.gitTimeout)
+	GitTimeout time.Duration
+	// Mux is where agents run: "direct" in wt's own terminal, or in a
+	// "tmux" or "zellij" session per wt session (wt.mux)
+	Mux string
+	// Setup lists shell commands run in each new session's worktree before
+	// the agent starts, e.g. to install dependencies (wt.setup, repeatable)
+	Setup []string
+	// Warm lists directories, such as node_modules, that new sessions clone
+	// from the main checkout before setup runs, each as path or
+	// path:strategy with strategy reflink, hardlink or copy (wt.warm,
+	// repeatable)
+	Warm []string
+	// Sparse lists the directories new sessions check out, for monorepos
+	// where a full checkout is slow or huge; empty checks out everything
+	// (wt.sparse, repeatable)
+	Sparse []string
+	// Submodules checks out the submodules of new sessions, copying
+	// objects from the main checkout's clones of them (wt.submodules)
+	Submodules bool
+	// LFS is how new sessions get the content of Git LFS files: "smudge"
+	// downloads everything during checkout, "skip" only what LFSInclude
+	// matches, and "share" fills in what the main checkout already has
+	// (wt.lfs)
+	LFS string
+	// LFSInclude lists patterns of the LFS files "skip" downloads, e.g.
+	// assets/icons/** (wt.lfsInclude, repeatable)
+	LFSInclude []string
+	// Ports is the range, e.g. 4000-4999, that each session is given its own
+	// block of ports from, so agents' dev servers don't collide; empty
+	// allocates none (wt.ports)
+	Ports string
+	// PortBlock is how many ports each session gets (wt.portBlock)
+	PortBlock int
+	// LockTimeout bounds how long to wait for another wt process working on
+	// the same repository; zero waits forever (wt.lockTimeout)
+	LockTimeout time.Duration
+	// Names is how sessions created without a name are named: "timestamp",
+	// "memorable", "prompt", "counter" or "template" (wt.names)
+	Names string
+	// NameTemplate is the template used when Names is "template", e.g.
+	// {user}-{date}-{n} (wt.nameTemplate)
+	NameTemplate string
+	// Slugify turns the names given to wt new into valid session names, e.g.
+	// "Fix login bug" into fix-login-bug, instead of rejecting them
+	// (wt.slugify)
+	Slugify bool
+	// Picker chooses a session when a command is run without one: "builtin"
+	// or "fzf" (wt.picker)
+	Picker string
+}
+
+// Default returns the settings used when nothing is configured
+func Default() Config {
+	return Config{
+		Base:         "remote",
+		Mux:          "direct",
+		Picker:       "builtin",
+		LFS:          "smudge",
+		Names:        "timestamp",
+		NameTemplate: "{user}-{date}-{n}",
+		Fetch:        true,
+		PortBlock:    10,
+		FetchTimeout: 2 * time.Minute,
+		LockTimeout:  5 * time.Minute,
+	}
+}
+
+// Load reads settings from git config, falling back to Default for unset keys
+func Load(ctx context.Context, repo *git.Repo) (Config, error) {
+	cfg := Default()
+
+	values, err := repo.ConfigValues(ctx, `^wt\.`)
+	if err != nil {
+		return cfg, err
+	}
+	s := settings(values)
+
+	if err := s.oneOf("wt.base", &cfg.Base, "remote", "local"); err != nil {
+		return cfg, err
+	}
+	if err := s.oneOf("wt.mux", &cfg.Mux, "direct", "tmux", "zellij"); err != nil {
+		return cfg, err
+	}
+	if err := s.oneOf("wt.names", &cfg.Names, "timestamp", "memorable", "prompt", "counter", "template"); err != nil {
+		return cfg, err
+	}
+	if err := s.oneOf("wt.lfs", &cfg.LFS, "smudge", "skip", "share"); err != nil {
+		return cfg, err
+	}
+	if template, ok := s.last("wt.nametemplate"); ok {
+		cfg.NameTemplate = template
+	}
+	if err := s.oneOf("wt.picker", &cfg.Picker, "builtin", "fzf"); err != nil {
+		return cfg, err
+	}
+	if err := s.bool("wt.fetch", &cfg.Fetch); err != nil {
+		return cfg, err
+	}
+	if err := s.bool("wt.slugify", &cfg.Slugify); err != nil {
+		return cfg, err
+	}
+	if err := s.bool("wt.submodules", &cfg.Submodules); err != nil {
+		return cfg, err
+	}
+	if err := s.number("wt.portblock", &cfg.PortBlock); err != nil {
+		return cfg, err
+	}
+	if err := s.duration("wt.fetchinterval", &cfg.FetchInterval); err != nil {
+		return cfg, err
+	}
+	if err := s.duration("wt.fetchtimeout", &cfg.FetchTimeout); err != nil {
+		return cfg, err
+	}
+	if err := s.duration("wt.gittimeout", &cfg.GitTimeout); err != nil {
+		return cfg, err
+	}
+	if err := s.duration("wt.locktimeout", &cfg.LockTimeout); err != nil {
+		return cfg, err
+	}
+	cfg.Setup = s["wt.setup"]
+	cfg.Warm = s["wt.warm"]
+	cfg.Sparse = s["wt.sparse"]
+	cfg.LFSInclude = s["wt.lfsinclude"]
+	cfg.Ports, _ = s.last("wt.ports")
+
+	return cfg, nil
+}
+
+// settings holds raw git config values keyed by lowercased name
+type settings map[string][]string
+
+// last returns the last value of key, which takes precedence in git config
+func (s settings) last(key string) (string, bool) {
+	values := s[key]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// duration parses key as a Go duration such as "30s" or "2m"
+func (s settings) duration(key string, dst *time.Duration) error {
+	value, ok := s.last(key)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid %s %q: want a duration such as 30s or 2m", key, value)
+	}
+	*dst = d
+	return nil
+}
+
+// number parses key as a positive integer
+func (s settings) number(key string, dst *int) error {
+	value, ok := s.last(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid %s %q: want a positive number", key, value)
+	}
+	*dst = n
+	return nil
+}
+
+// bool parses key using git's boolean spellings
+func (s settings) bool(key string, dst *bool) error {
+	value, ok := s.last(key)
+	if !ok {
+		return nil
+	}
+	switch strings.ToLower(value) {
+	// A key with no "= value" is true in git
+	case "", "true", "yes", "on", "1":
+		*dst = true
+	case "false", "no", "off", "0":
+		*dst = false
+	default:
+		return fmt.Errorf("invalid %s %q: want true or false", key, value)
+	}
+	return nil
+}
+
+// oneOf reads key, which must be one of allowed
+func (s settings) oneOf(key string, dst *string, allowed ...string) error {
+	value, ok := s.last(key)
+	if !ok {
+		return nil
+	}
+	if !slices.Contains(allowed, value) {
+		return fmt.Errorf("invalid %s %q: want %s", key, value, strings.Join(allowed, " or "))
+	}
+	*dst = value
+	return nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/git/gittest"
+)
+
+// load runs Load against a fake `git config -z --get-regexp` listing entries
+func load(t *testing.T, entries ...string) (Config, error) {
+	t.Helper()
+	var out strings.Builder
+	for _, e := range entries {
+		key, value, _ := strings.Cut(e, "=")
+		out.WriteString(key + "\n" + value + "\x00")
+	}
+	runner := (&gittest.Runner{}).On("config -z --get-regexp", out.String(), nil)
+	return Load(t.Context(), git.New(runner, io.Discard, io.Discard))
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load() = %+v, want defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoadDurations(t *testing.T) {
+	cfg, err := load(t, "wt.fetchtimeout=5s", "wt.gittimeout=1m", "wt.fetchtimeout=10s")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.FetchTimeout != 10*time.Second {
+		t.Errorf("FetchTimeout = %s, want last value 10s", cfg.FetchTimeout)
+	}
+	if cfg.GitTimeout != time.Minute {
+		t.Errorf("GitTimeout = %s, want 1m", cfg.GitTimeout)
+	}
+}
+
+func TestLoadFetch(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"false", false},
+		{"off", false},
+		{"yes", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		cfg, err := load(t, "wt.fetch="+tt.value)
+		if err != nil {
+			t.Fatalf("Load(wt.fetch=%q) error: %v", tt.value, err)
+		}
+		if cfg.Fetch != tt.want {
+			t.Errorf("Load(wt.fetch=%q).Fetch = %v, want %v", tt.value, cfg.Fetch, tt.want)
+		}
+	}
+
+	if _, err := load(t, "wt.fetch=maybe"); err == nil {
+		t.Error("Load(wt.fetch=maybe) should fail")
+	}
+}
+
+func TestLoadInvalidDuration(t *testing.T) {
+	_, err := load(t, "wt.fetchtimeout=soon")
+	if err == nil || !strings.Contains(err.Error(), "wt.fetchtimeout") {
+		t.Fatalf("Load() error = %v, want invalid wt.fetchtimeout", err)
+	}
+}
+
+func TestLoadSetup(t *testing.T) {
+	cfg, err := load(t, "wt.setup=npm ci", "wt.setup=make generate")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	want := []string{"npm ci", "make generate"}
+	if !reflect.DeepEqual(cfg.Setup, want) {
+		t.Errorf("Setup = %q, want every value in order %q", cfg.Setup, want)
+	}
+}
+
+func TestLoadNames(t *testing.T) {
+	cfg, err := load(t, "wt.names=template", "wt.nametemplate={user}-{n}")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Names != "template" || cfg.NameTemplate != "{user}-{n}" {
+		t.Errorf("Names = %q, NameTemplate = %q", cfg.Names, cfg.NameTemplate)
+	}
+
+	if _, err := load(t, "wt.names=random"); err == nil || !strings.Contains(err.Error(), "wt.names") {
+		t.Errorf("Load(wt.names=random) error = %v, want invalid wt.names", err)
+	}
+}
+
+func TestLoadLFS(t *testing.T) {
+	cfg, err := load(t, "wt.lfs=skip", "wt.lfsinclude=assets/**", "wt.lfsinclude=*.psd")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.LFS != "skip" || !reflect.DeepEqual(cfg.LFSInclude, []string{"assets/**", "*.psd"}) {
+		t.Errorf("LFS = %q, LFSInclude = %q", cfg.LFS, cfg.LFSInclude)
+	}
+
+	if _, err := load(t, "wt.lfs=never"); err == nil || !strings.Contains(err.Error(), "wt.lfs") {
+		t.Errorf("Load(wt.lfs=never) error = %v, want invalid wt.lfs", err)
+	}
+}
+
+func TestLoadPorts(t *testing.T) {
+	cfg, err := load(t, "wt.ports=4000-4999", "wt.portblock=5")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Ports != "4000-4999" || cfg.PortBlock != 5 {
+		t.Errorf("Ports = %q, PortBlock = %d", cfg.Ports, cfg.PortBlock)
+	}
+
+	if _, err := load(t, "wt.portblock=0"); err == nil || !strings.Contains(err.Error(), "wt.portblock") {
+		t.Errorf("Load(wt.portblock=0) error = %v, want invalid wt.portblock", err)
+	}
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotARepo is returned when the working directory is not inside a git repository
+	ErrNotARepo = errors.New("not in a git repository")
+	// ErrDirtyWorktree is returned when uncommitted changes in a worktree
+	// are in the way
+	ErrDirtyWorktree = errors.New("worktree has uncommitted changes")
+)
+
+// CommandError is returned when a git command fails. Stderr holds git's own
+// explanation, which is usually more useful than the exit status.
+type CommandError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	if msg := strings.TrimSpace(e.Stderr); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
@@ -2,11 +2,16 @@ package git
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Worktree represents a git worktree
@@ -16,19 +21,69 @@ type Worktree struct {
 	Branch string
 }
 
-// GetRepoRoot returns the root directory of the current git repository
-func GetRepoRoot() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	output, err := cmd.Output()
+// Repo runs git operations through a Runner
+type Repo struct {
+	// Timeout bounds each local git command; zero means no limit
+	Timeout time.Duration
+	// FetchTimeout bounds commands that talk to a remote; zero means no limit
+	FetchTimeout time.Duration
+
+	runner Runner
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// New returns a Repo that runs commands with r. Output of long-running
+// commands such as fetch is streamed to stdout and stderr.
+func New(r Runner, stdout, stderr io.Writer) *Repo {
+	return &Repo{runner: r, stdout: stdout, stderr: stderr}
+}
+
+// NewExec returns a Repo backed by the git binary in the current directory
+func NewExec() *Repo {
+	return New(ExecRunner{}, os.Stdout, os.Stderr)
+}
+
+// GetRepoRoot returns the root directory of the current git repository.
+// Inside a linked worktree, such as a session's, that is the main checkout
+// the worktree belongs to.
+func (r *Repo) GetRepoRoot(ctx context.Context) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "rev-parse", "--show-toplevel", "--path-format=absolute", "--git-dir", "--git-common-dir")
 	if err != nil {
-		return "", fmt.Errorf("not in a git repository: %w", err)
+		// Git ran but refused: we're outside a repository
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Stderr != "" {
+			return "", fmt.Errorf("%w: %w", ErrNotARepo, err)
+		}
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	root := lines[0]
+	// A linked worktree has its own git directory; the main checkout is the
+	// one holding the shared .git directory
+	if len(lines) == 3 && lines[1] != lines[2] && filepath.Base(lines[2]) == ".git" {
+		root = filepath.Dir(lines[2])
 	}
-	return strings.TrimSpace(string(output)), nil
+	return root, nil
+}
+
+// GetCommonDir returns the absolute path of the repository's .git directory,
+// shared by all of its worktrees
+func (r *Repo) GetCommonDir(ctx context.Context) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory: %w", err)
+	}
+	dir := strings.TrimSpace(output)
+	if dir == "" {
+		return "", fmt.Errorf("failed to locate git directory: no output from git")
+	}
+	return dir, nil
 }
 
 // GetRepoName returns the name of the repository (directory name)
-func GetRepoName() (string, error) {
-	root, err := GetRepoRoot()
+func (r *Repo) GetRepoName(ctx context.Context) (string, error) {
+	root, err := r.GetRepoRoot(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -36,126 +91,291 @@ func GetRepoName() (string, error) {
 }
 
 // GetCurrentBranch returns the current branch name
-func GetCurrentBranch() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	output, err := cmd.Output()
+func (r *Repo) GetCurrentBranch(ctx context.Context) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("failed to get current branch: %w", err)
 	}
-	return strings.TrimSpace(string(output)), nil
+	return strings.TrimSpace(output), nil
+}
+
+// GetBranchAt returns the branch checked out in the worktree at dir
+func (r *Repo) GetBranchAt(ctx context.Context, dir string) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "-C", dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch of %s: %w", dir, err)
+	}
+	return strings.TrimSpace(output), nil
 }
 
-// FetchOrigin fetches from origin
-func FetchOrigin() error {
-	cmd := exec.Command("git", "fetch", "origin")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to fetch from origin: %w", err)
+// BranchExists checks if a branch exists
+func (r *Repo) BranchExists(ctx context.Context, branch string) bool {
+	_, err := r.run(ctx, r.Timeout, "rev-parse", "--verify", branch)
+	return err == nil
+}
+
+// CreateBranch creates a new branch from the source branch
+func (r *Repo) CreateBranch(ctx context.Context, name, source string) error {
+	// --no-track: a session branch started from origin/main must not pull
+	// from or push to main
+	if _, err := r.run(ctx, r.Timeout, "branch", "--no-track", name, source); err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", name, err)
 	}
 	return nil
 }
 
-// FastForwardBranch attempts to fast-forward the specified branch to origin
-func FastForwardBranch(branch string) error {
-	// Check if remote branch exists
-	cmd := exec.Command("git", "rev-parse", "--verify", "origin/"+branch)
-	if err := cmd.Run(); err != nil {
-		// Remote branch doesn't exist, skip fast-forward
-		return nil
+// DeleteBranch deletes a branch forcefully
+func (r *Repo) DeleteBranch(ctx context.Context, branch string) error {
+	if _, err := r.run(ctx, r.Timeout, "branch", "-D", branch); err != nil {
+		return fmt.Errorf("failed to delete branch %s: %w", branch, err)
 	}
+	return nil
+}
 
-	// Get current branch to restore later
-	currentBranch, err := GetCurrentBranch()
+// ResolveCommit returns the full commit hash that ref points to
+func (r *Repo) ResolveCommit(ctx context.Context, ref string) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
 	}
+	return strings.TrimSpace(output), nil
+}
 
-	// If we're already on the branch, just pull
-	if currentBranch == branch {
-		cmd = exec.Command("git", "pull", "--ff-only")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to fast-forward %s: %w", branch, err)
-		}
-		return nil
+// CountCommits returns the number of commits reachable from to but not from
+// from, i.e. `git rev-list --count from..to`
+func (r *Repo) CountCommits(ctx context.Context, from, to string) (int, error) {
+	output, err := r.run(ctx, r.Timeout, "rev-list", "--count", from+".."+to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count commits in %s..%s: %w", from, to, err)
 	}
-
-	// Otherwise, update the branch ref directly
-	cmd = exec.Command("git", "fetch", "origin", fmt.Sprintf("%s:%s", branch, branch))
-	if err := cmd.Run(); err != nil {
-		// Branch might not be fast-forwardable, that's ok
-		return nil
+	var n int
+	if _, err := fmt.Sscan(output, &n); err != nil {
+		return 0, fmt.Errorf("unexpected rev-list output %q", output)
 	}
-	return nil
+	return n, nil
 }
 
-// BranchExists checks if a branch exists
-func BranchExists(branch string) bool {
-	cmd := exec.Command("git", "rev-parse", "--verify", branch)
-	return cmd.Run() == nil
+// AheadBehind returns how many commits ref has that base doesn't (ahead)
+// and how many base has that ref doesn't (behind)
+func (r *Repo) AheadBehind(ctx context.Context, base, ref string) (ahead, behind int, err error) {
+	output, err := r.run(ctx, r.Timeout, "rev-list", "--left-right", "--count", base+"..."+ref)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: %w", ref, base, err)
+	}
+	if _, err := fmt.Sscan(output, &behind, &ahead); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", output)
+	}
+	return ahead, behind, nil
 }
 
-// CreateBranch creates a new branch from the source branch
-func CreateBranch(name, source string) error {
-	cmd := exec.Command("git", "branch", name, source)
-	output, err := cmd.CombinedOutput()
+// MergeBase returns the best common ancestor of a and b
+func (r *Repo) MergeBase(ctx context.Context, a, b string) (string, error) {
+	output, err := r.run(ctx, r.Timeout, "merge-base", a, b)
 	if err != nil {
-		return fmt.Errorf("failed to create branch %s: %s", name, string(output))
+		return "", fmt.Errorf("failed to find the merge base of %s and %s: %w", a, b, err)
 	}
-	return nil
+	return strings.TrimSpace(output), nil
 }
 
-// DeleteBranch deletes a branch forcefully
-func DeleteBranch(branch string) error {
-	cmd := exec.Command("git", "branch", "-D", branch)
-	output, err := cmd.CombinedOutput()
+// HeadCommit returns the hash and subject of the commit checked out in the
+// worktree at path
+func (r *Repo) HeadCommit(ctx context.Context, path string) (hash, subject string, err error) {
+	output, err := r.run(ctx, r.Timeout, "-C", path, "log", "-1", "--format=%H%x00%s")
 	if err != nil {
-		return fmt.Errorf("failed to delete branch %s: %s", branch, string(output))
+		return "", "", fmt.Errorf("failed to read HEAD of %s: %w", path, err)
 	}
-	return nil
+	hash, subject, _ = strings.Cut(strings.TrimSpace(output), "\x00")
+	return hash, subject, nil
 }
 
 // HasCommits checks if a branch has at least one commit
-func HasCommits(branch string) bool {
-	cmd := exec.Command("git", "rev-parse", branch)
-	return cmd.Run() == nil
+func (r *Repo) HasCommits(ctx context.Context, branch string) bool {
+	_, err := r.run(ctx, r.Timeout, "rev-parse", branch)
+	return err == nil
 }
 
 // AddWorktree creates a new worktree at the specified path
-func AddWorktree(path, branch string) error {
-	cmd := exec.Command("git", "worktree", "add", path, branch)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+func (r *Repo) AddWorktree(ctx context.Context, path, branch string) error {
+	return r.AddWorktreeWith(ctx, path, branch, WorktreeOptions{})
+}
+
+// WorktreeOptions controls how AddWorktreeWith checks out a new worktree
+type WorktreeOptions struct {
+	// Sparse checks out only these directories, plus the files at the top
+	// level (cone-mode sparse checkout); empty checks out everything
+	Sparse []string
+	// SkipSmudge leaves Git LFS files as pointers instead of downloading
+	// their content during the checkout
+	SkipSmudge bool
+}
+
+// AddWorktreeWith creates a new worktree at the specified path. A sparse
+// worktree is checked out only once its cone is set, so nothing outside it
+// is ever written.
+func (r *Repo) AddWorktreeWith(ctx context.Context, path, branch string, opts WorktreeOptions) error {
+	var config []string
+	if opts.SkipSmudge {
+		config = lfsSkipSmudge
+	}
+	if len(opts.Sparse) == 0 {
+		if err := r.stream(ctx, r.Timeout, slices.Concat(config, []string{"worktree", "add", path, branch})...); err != nil {
+			return fmt.Errorf("failed to create worktree: %w", err)
+		}
+		return nil
+	}
+
+	if err := r.stream(ctx, r.Timeout, "worktree", "add", "--no-checkout", path, branch); err != nil {
 		return fmt.Errorf("failed to create worktree: %w", err)
 	}
+	args := append([]string{"-C", path, "sparse-checkout", "set", "--cone", "--"}, opts.Sparse...)
+	if _, err := r.run(ctx, r.Timeout, args...); err != nil {
+		return fmt.Errorf("failed to set up sparse checkout: %w", err)
+	}
+	if err := r.stream(ctx, r.Timeout, slices.Concat(config, []string{"-C", path, "checkout"})...); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", branch, err)
+	}
 	return nil
 }
 
-// RemoveWorktree removes a worktree forcefully
-func RemoveWorktree(path string) error {
-	cmd := exec.Command("git", "worktree", "remove", "--force", path)
-	output, err := cmd.CombinedOutput()
+// SparseAdd widens the sparse checkout of the worktree at dir to include
+// paths
+func (r *Repo) SparseAdd(ctx context.Context, dir string, paths []string) error {
+	args := append([]string{"-C", dir, "sparse-checkout", "add", "--"}, paths...)
+	if _, err := r.run(ctx, r.Timeout, args...); err != nil {
+		return fmt.Errorf("failed to widen sparse checkout: %w", err)
+	}
+	return nil
+}
+
+// SparsePaths returns the directories checked out in the worktree at dir,
+// and false if it has a full checkout
+func (r *Repo) SparsePaths(ctx context.Context, dir string) ([]string, bool, error) {
+	output, err := r.run(ctx, r.Timeout, "-C", dir, "sparse-checkout", "list")
 	if err != nil {
-		return fmt.Errorf("failed to remove worktree: %s", string(output))
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "not sparse") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to list sparse checkout: %w", err)
+	}
+	var paths []string
+	for line := range strings.Lines(output) {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, true, nil
+}
+
+// Merge merges branch into whatever is checked out in the worktree at dir.
+// It fails with ErrDirtyWorktree if uncommitted changes there are in the way.
+func (r *Repo) Merge(ctx context.Context, dir, branch string) error {
+	if _, err := r.run(ctx, r.Timeout, "-C", dir, "merge", "--no-edit", branch); err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "would be overwritten by merge") {
+			return fmt.Errorf("failed to merge %s: %w: %w", branch, ErrDirtyWorktree, err)
+		}
+		return fmt.Errorf("failed to merge %s: %w", branch, err)
+	}
+	return nil
+}
+
+// HasChanges reports whether the worktree at path has uncommitted changes,
+// including untracked files
+func (r *Repo) HasChanges(ctx context.Context, path string) (bool, error) {
+	output, err := r.run(ctx, r.Timeout, "-C", path, "status", "--porcelain")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status of %s: %w", path, err)
+	}
+	return strings.TrimSpace(output) != "", nil
+}
+
+// RemoveWorktree removes a worktree forcefully
+func (r *Repo) RemoveWorktree(ctx context.Context, path string) error {
+	if _, err := r.run(ctx, r.Timeout, "worktree", "remove", "--force", path); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
+	return nil
+}
+
+// PruneWorktrees forgets worktrees whose directories no longer exist
+func (r *Repo) PruneWorktrees(ctx context.Context) error {
+	if _, err := r.run(ctx, r.Timeout, "worktree", "prune"); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w", err)
 	}
 	return nil
 }
 
 // ListWorktrees returns all worktrees in porcelain format
-func ListWorktrees() ([]Worktree, error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
-	output, err := cmd.Output()
+func (r *Repo) ListWorktrees(ctx context.Context) ([]Worktree, error) {
+	output, err := r.run(ctx, r.Timeout, "worktree", "list", "--porcelain")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list worktrees: %w", err)
 	}
+	return parseWorktrees(output), nil
+}
+
+// ConfigValues returns the values of all git config keys matching the
+// regular expression pattern. Keys are returned as git prints them, with the
+// section and variable names lowercased.
+func (r *Repo) ConfigValues(ctx context.Context, pattern string) (map[string][]string, error) {
+	output, err := r.run(ctx, r.Timeout, "config", "-z", "--get-regexp", pattern)
+	if err != nil {
+		// git config exits 1 when no key matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return map[string][]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	values := map[string][]string{}
+	for _, entry := range strings.Split(output, "\x00") {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "\n")
+		values[key] = append(values[key], value)
+	}
+	return values, nil
+}
+
+// run runs a git command bounded by timeout and returns its stdout
+func (r *Repo) run(ctx context.Context, timeout time.Duration, args ...string) (string, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	output, err := r.runner.Output(ctx, args...)
+	return output, timeoutError(args, timeout, err)
+}
+
+// stream runs a git command bounded by timeout, streaming its output
+func (r *Repo) stream(ctx context.Context, timeout time.Duration, args ...string) error {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	return timeoutError(args, timeout, r.runner.Stream(ctx, r.stdout, r.stderr, args...))
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError explains errors caused by the command's own deadline
+func timeoutError(args []string, timeout time.Duration, err error) error {
+	if timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("git %s timed out after %s: %w", args[0], timeout, err)
+	}
+	return err
+}
 
+// parseWorktrees parses the output of `git worktree list --porcelain`
+func parseWorktrees(output string) []Worktree {
 	var worktrees []Worktree
 	var current Worktree
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	scanner := bufio.NewScanner(strings.NewReader(output))
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == "" {
@@ -180,5 +400,5 @@ func ListWorktrees() ([]Worktree, error) {
 		worktrees = append(worktrees, current)
 	}
 
-	return worktrees, nil
+	return worktrees
 }
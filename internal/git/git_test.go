@@ -0,0 +1,137 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/git/gittest"
+)
+
+func TestListWorktrees(t *testing.T) {
+	runner := &gittest.Runner{}
+	runner.On("worktree list --porcelain", strings.Join([]string{
+		"worktree /src/repo",
+		"HEAD 1111",
+		"branch refs/heads/main",
+		"",
+		"worktree /home/u/.wt/repo-a",
+		"HEAD 2222",
+		"branch refs/heads/wt-a",
+		"",
+		"worktree /home/u/.wt/repo-detached",
+		"HEAD 3333",
+		"detached",
+	}, "\n"), nil)
+
+	worktrees, err := git.New(runner, io.Discard, io.Discard).ListWorktrees(t.Context())
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+
+	want := []git.Worktree{
+		{Path: "/src/repo", Head: "1111", Branch: "main"},
+		{Path: "/home/u/.wt/repo-a", Head: "2222", Branch: "wt-a"},
+		{Path: "/home/u/.wt/repo-detached", Head: "3333"},
+	}
+	if len(worktrees) != len(want) {
+		t.Fatalf("got %d worktrees, want %d", len(worktrees), len(want))
+	}
+	for i := range want {
+		if worktrees[i] != want[i] {
+			t.Errorf("worktree %d = %+v, want %+v", i, worktrees[i], want[i])
+		}
+	}
+}
+
+func TestCreateBranchError(t *testing.T) {
+	runner := &gittest.Runner{}
+	runner.On("branch", "", errors.New("fatal: a branch named 'x' already exists"))
+
+	err := git.New(runner, io.Discard, io.Discard).CreateBranch(t.Context(), "x", "main")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("CreateBranch() error = %v, want git's message", err)
+	}
+}
+
+func TestLocalCommandsIgnoreFetchTimeout(t *testing.T) {
+	runner := (&gittest.Runner{}).On("branch", "", nil)
+	repo := git.New(runner, io.Discard, io.Discard)
+	repo.FetchTimeout = time.Nanosecond
+
+	if err := repo.CreateBranch(t.Context(), "x", "main"); err != nil {
+		t.Fatalf("CreateBranch() error: %v", err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := git.New(&gittest.Runner{}, io.Discard, io.Discard).GetRepoRoot(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetRepoRoot() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	runner := (&gittest.Runner{}).On("rev-list --left-right --count origin/main...wt-a", "1\t3\n", nil)
+
+	ahead, behind, err := git.New(runner, io.Discard, io.Discard).AheadBehind(t.Context(), "origin/main", "wt-a")
+	if err != nil {
+		t.Fatalf("AheadBehind() error: %v", err)
+	}
+	if ahead != 3 || behind != 1 {
+		t.Errorf("AheadBehind() = %d ahead, %d behind; want 3, 1", ahead, behind)
+	}
+}
+
+func TestGetRepoRootFromWorktree(t *testing.T) {
+	tests := map[string]string{
+		"/src/myrepo\n/src/myrepo/.git\n/src/myrepo/.git\n":                              "/src/myrepo",
+		"/home/me/.wt/myrepo-a\n/src/myrepo/.git/worktrees/myrepo-a\n/src/myrepo/.git\n": "/src/myrepo",
+		"/src/myrepo\n": "/src/myrepo",
+	}
+	for output, want := range tests {
+		runner := (&gittest.Runner{}).On("rev-parse --show-toplevel", output, nil)
+		root, err := git.New(runner, io.Discard, io.Discard).GetRepoRoot(t.Context())
+		if err != nil {
+			t.Fatalf("GetRepoRoot() error: %v", err)
+		}
+		if root != want {
+			t.Errorf("GetRepoRoot() with rev-parse output %q = %q, want %q", output, root, want)
+		}
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	runner := &gittest.Runner{}
+	runner.On("-C /wt config -z -f .gitmodules", "submodule.vendor/lib.path\nvendor/lib\x00submodule.docs.theme.path\nthemes/my theme\x00", nil)
+
+	submodules, err := git.New(runner, io.Discard, io.Discard).Submodules(t.Context(), "/wt")
+	if err != nil {
+		t.Fatalf("Submodules() error: %v", err)
+	}
+	want := []git.Submodule{{Name: "vendor/lib", Path: "vendor/lib"}, {Name: "docs.theme", Path: "themes/my theme"}}
+	if !slices.Equal(submodules, want) {
+		t.Errorf("Submodules() = %+v, want %+v", submodules, want)
+	}
+}
+
+func TestUnpushedSubmodules(t *testing.T) {
+	runner := &gittest.Runner{}
+	runner.On("-C /wt submodule foreach", "0 vendor/lib\n2 vendor/lib/nested dir\n", nil)
+
+	paths, err := git.New(runner, io.Discard, io.Discard).UnpushedSubmodules(t.Context(), "/wt")
+	if err != nil {
+		t.Fatalf("UnpushedSubmodules() error: %v", err)
+	}
+	if want := []string{"vendor/lib/nested dir"}; !slices.Equal(paths, want) {
+		t.Errorf("UnpushedSubmodules() = %q, want %q", paths, want)
+	}
+}
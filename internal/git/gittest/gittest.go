@@ -0,0 +1,117 @@
+// Package gittest provides a recording fake of git.Runner for unit tests.
+package gittest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/emilrex/wt/internal/git"
+)
+
+// Runner is a fake git.Runner. It records every call and replies with
+// results registered through On. Calls without a registered result succeed
+// with empty output.
+type Runner struct {
+	mu    sync.Mutex
+	calls [][]string
+	stubs []stub
+}
+
+type stub struct {
+	prefix string
+	out    string
+	err    error
+	hang   bool
+}
+
+// On registers the result for calls whose space-joined arguments equal cmd
+// or start with cmd followed by a space. Later registrations take precedence.
+func (r *Runner) On(cmd, out string, err error) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stubs = append(r.stubs, stub{prefix: cmd, out: out, err: err})
+	return r
+}
+
+// Hang makes calls matching cmd block until their context is done, like a
+// git process stuck on the network
+func (r *Runner) Hang(cmd string) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stubs = append(r.stubs, stub{prefix: cmd, hang: true})
+	return r
+}
+
+// Output records the call and returns the registered result
+func (r *Runner) Output(ctx context.Context, args ...string) (string, error) {
+	return r.record(ctx, args)
+}
+
+// Stream records the call and writes the registered output to stdout
+func (r *Runner) Stream(ctx context.Context, stdout, _ io.Writer, args ...string) error {
+	out, err := r.record(ctx, args)
+	if out != "" {
+		_, _ = io.WriteString(stdout, out)
+	}
+	return err
+}
+
+// Calls returns the arguments of every call made so far, space-joined
+func (r *Runner) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]string, len(r.calls))
+	for i, c := range r.calls {
+		calls[i] = strings.Join(c, " ")
+	}
+	return calls
+}
+
+// Called reports whether a call matching cmd was made
+func (r *Runner) Called(cmd string) bool {
+	for _, c := range r.Calls() {
+		if matches(c, cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) record(ctx context.Context, args []string) (string, error) {
+	s := r.lookup(args)
+	if s.hang {
+		<-ctx.Done()
+	}
+	// Like exec.CommandContext, a done context fails the command
+	if err := ctx.Err(); err != nil {
+		return "", &git.CommandError{Args: args, Err: err}
+	}
+	return s.out, s.err
+}
+
+// lookup records the call and returns the stub that answers it
+func (r *Runner) lookup(args []string) stub {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, append([]string(nil), args...))
+
+	joined := strings.Join(args, " ")
+	for i := len(r.stubs) - 1; i >= 0; i-- {
+		if matches(joined, r.stubs[i].prefix) {
+			return r.stubs[i]
+		}
+	}
+	return stub{}
+}
+
+func matches(call, cmd string) bool {
+	return call == cmd || strings.HasPrefix(call, cmd+" ")
+}
+
+// Fail returns the error the exec runner reports when git exits with stderr
+func Fail(stderr string) error {
+	return &git.CommandError{Stderr: stderr, Err: errors.New("exit status 128")}
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// lfsSkipSmudge configures a single git command to leave Git LFS files as
+// pointers, as `git lfs install --skip-smudge` does for good
+var lfsSkipSmudge = []string{
+	"-c", "filter.lfs.smudge=git-lfs smudge --skip -- %f",
+	"-c", "filter.lfs.process=git-lfs filter-process --skip",
+}
+
+// UsesLFS reports whether any .gitattributes file at commit routes files
+// through Git LFS
+func (r *Repo) UsesLFS(ctx context.Context, commit string) (bool, error) {
+	_, err := r.run(ctx, r.Timeout, "grep", "-q", "-e", "filter=lfs", commit, "--", ":(glob)**/.gitattributes")
+	if err == nil {
+		return true, nil
+	}
+	// git grep exits 1 when nothing matches
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to look for Git LFS attributes: %w", err)
+}
+
+// LFSPull downloads the Git LFS files of the worktree at dir that match the
+// include patterns and replaces their pointers
+func (r *Repo) LFSPull(ctx context.Context, dir string, include []string) error {
+	if err := r.stream(ctx, r.FetchTimeout, "-C", dir, "lfs", "pull", "--include="+strings.Join(include, ",")); err != nil {
+		return fmt.Errorf("failed to pull Git LFS files: %w", err)
+	}
+	return nil
+}
+
+// LFSCheckout replaces the Git LFS pointers of the worktree at dir with
+// content already in storage, the LFS object directory to use, without
+// downloading anything. Files whose content isn't there stay pointers.
+func (r *Repo) LFSCheckout(ctx context.Context, dir, storage string) error {
+	if err := r.stream(ctx, r.Timeout, "-C", dir, "-c", "lfs.storage="+storage, "lfs", "checkout"); err != nil {
+		return fmt.Errorf("failed to check out Git LFS files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package git
+
+import "os/exec"
+
+// setCancel keeps exec's default of killing git on cancellation
+func setCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package git
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCancel runs git in its own process group and interrupts the whole group
+// on cancellation, so helpers such as ssh or a nested `git fetch` under
+// `git pull` don't outlive it
+func setCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+	}
+}
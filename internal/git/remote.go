@@ -0,0 +1,141 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Upstream is the remote branch a local branch is based on
+type Upstream struct {
+	Remote string
+	Branch string
+}
+
+func (u Upstream) String() string {
+	return u.Remote + "/" + u.Branch
+}
+
+// TrackingRef returns the remote-tracking ref wt fetches u into
+func (u Upstream) TrackingRef() string {
+	return fmt.Sprintf("refs/remotes/%s/%s", u.Remote, u.Branch)
+}
+
+// GetRemotes returns the names of the configured remotes
+func (r *Repo) GetRemotes(ctx context.Context) ([]string, error) {
+	output, err := r.run(ctx, r.Timeout, "remote")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	return strings.Fields(output), nil
+}
+
+// GetUpstream returns the remote branch that branch tracks, as configured by
+// `git branch --set-upstream-to`. Branches without an upstream fall back to
+// the same name on origin, if there is an origin. ok is false when there is
+// no remote to update branch from.
+func (r *Repo) GetUpstream(ctx context.Context, branch string) (u Upstream, ok bool, err error) {
+	prefix := "branch." + branch + "."
+	values, err := r.ConfigValues(ctx, "^"+regexp.QuoteMeta(prefix)+"(remote|merge)$")
+	if err != nil {
+		return Upstream{}, false, err
+	}
+
+	remote := last(values[prefix+"remote"])
+	merge := last(values[prefix+"merge"])
+	if remote != "" && merge != "" {
+		// "." means the upstream is another local branch
+		if remote == "." {
+			return Upstream{}, false, nil
+		}
+		return Upstream{Remote: remote, Branch: strings.TrimPrefix(merge, "refs/heads/")}, true, nil
+	}
+
+	remotes, err := r.GetRemotes(ctx)
+	if err != nil {
+		return Upstream{}, false, err
+	}
+	for _, name := range remotes {
+		if name == "origin" {
+			return Upstream{Remote: "origin", Branch: branch}, true, nil
+		}
+	}
+	return Upstream{}, false, nil
+}
+
+// Fetch fetches only u's branch, updating its remote-tracking ref
+func (r *Repo) Fetch(ctx context.Context, u Upstream) error {
+	refspec := fmt.Sprintf("+refs/heads/%s:%s", u.Branch, u.TrackingRef())
+	if err := r.stream(ctx, r.FetchTimeout, "fetch", u.Remote, refspec); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	return nil
+}
+
+// LastFetched returns when u was last fetched, based on FETCH_HEAD. ok is
+// false if the last fetch did not include u's branch.
+func (r *Repo) LastFetched(ctx context.Context, u Upstream) (t time.Time, ok bool, err error) {
+	output, err := r.run(ctx, r.Timeout, "rev-parse", "--git-path", "FETCH_HEAD")
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to locate FETCH_HEAD: %w", err)
+	}
+	path := strings.TrimSpace(output)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if !strings.Contains(string(data), fmt.Sprintf("branch '%s' of ", u.Branch)) {
+		return time.Time{}, false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return info.ModTime(), true, nil
+}
+
+// FastForwardBranch attempts to fast-forward branch to u's remote-tracking
+// ref. It does not contact the remote; fetch first to pick up new commits.
+func (r *Repo) FastForwardBranch(ctx context.Context, branch string, u Upstream) error {
+	// Check if remote branch exists
+	if _, err := r.run(ctx, r.Timeout, "rev-parse", "--verify", u.TrackingRef()); err != nil {
+		// Remote branch doesn't exist, skip fast-forward
+		return nil
+	}
+
+	currentBranch, err := r.GetCurrentBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	// If we're on the branch, fast-forward the checkout too
+	if currentBranch == branch {
+		if err := r.stream(ctx, r.Timeout, "merge", "--ff-only", u.TrackingRef()); err != nil {
+			return fmt.Errorf("failed to fast-forward %s: %w", branch, err)
+		}
+		return nil
+	}
+
+	// Otherwise, update the branch ref directly.
+	// Branch might not be fast-forwardable, that's ok
+	_, _ = r.run(ctx, r.Timeout, "fetch", ".", fmt.Sprintf("%s:refs/heads/%s", u.TrackingRef(), branch))
+	return nil
+}
+
+// last returns the final value of a multi-valued config key, which takes
+// precedence in git
+func last(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
@@ -0,0 +1,135 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/git/gittest"
+)
+
+var origin = git.Upstream{Remote: "origin", Branch: "main"}
+
+func TestGetUpstream(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		remotes string
+		want    git.Upstream
+		wantOK  bool
+	}{
+		{"configured", "branch.feat.remote\nupstream\x00branch.feat.merge\nrefs/heads/feature-x\x00", "origin\nupstream\n", git.Upstream{Remote: "upstream", Branch: "feature-x"}, true},
+		{"local upstream", "branch.feat.remote\n.\x00branch.feat.merge\nrefs/heads/main\x00", "origin\n", git.Upstream{}, false},
+		{"origin fallback", "", "origin\n", git.Upstream{Remote: "origin", Branch: "feat"}, true},
+		{"no origin", "", "fork\n", git.Upstream{}, false},
+		{"no remotes", "", "", git.Upstream{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &gittest.Runner{}
+			runner.On("config -z --get-regexp", tt.config, nil)
+			runner.On("remote", tt.remotes, nil)
+
+			got, ok, err := git.New(runner, io.Discard, io.Discard).GetUpstream(t.Context(), "feat")
+			if err != nil {
+				t.Fatalf("GetUpstream() error: %v", err)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("GetUpstream() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFetchOnlyFetchesOneBranch(t *testing.T) {
+	runner := &gittest.Runner{}
+	runner.On("fetch", "From origin\n", nil)
+
+	var out bytes.Buffer
+	if err := git.New(runner, &out, io.Discard).Fetch(t.Context(), origin); err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if !runner.Called("fetch origin +refs/heads/main:refs/remotes/origin/main") {
+		t.Errorf("expected a single-branch fetch, calls: %v", runner.Calls())
+	}
+	if out.String() != "From origin\n" {
+		t.Errorf("output = %q, want streamed fetch output", out.String())
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	runner := (&gittest.Runner{}).Hang("fetch")
+	repo := git.New(runner, io.Discard, io.Discard)
+	repo.FetchTimeout = 10 * time.Millisecond
+
+	err := repo.Fetch(t.Context(), origin)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Fatalf("Fetch() error = %v, want timeout", err)
+	}
+}
+
+func TestLastFetched(t *testing.T) {
+	fetchHead := filepath.Join(t.TempDir(), "FETCH_HEAD")
+	runner := (&gittest.Runner{}).On("rev-parse --git-path FETCH_HEAD", fetchHead+"\n", nil)
+	repo := git.New(runner, io.Discard, io.Discard)
+
+	if _, ok, err := repo.LastFetched(t.Context(), origin); ok || err != nil {
+		t.Fatalf("LastFetched() without FETCH_HEAD = %v, %v, want not fetched", ok, err)
+	}
+
+	line := "1234\t\tbranch 'main' of /srv/origin\n"
+	if err := os.WriteFile(fetchHead, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fetched, ok, err := repo.LastFetched(t.Context(), origin)
+	if err != nil || !ok || time.Since(fetched) > time.Minute {
+		t.Errorf("LastFetched() = %v, %v, %v, want just now", fetched, ok, err)
+	}
+
+	other := git.Upstream{Remote: "origin", Branch: "develop"}
+	if _, ok, _ := repo.LastFetched(t.Context(), other); ok {
+		t.Error("LastFetched() should ignore fetches of other branches")
+	}
+}
+
+func TestFastForwardBranch(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		remote  bool
+		want    string
+		notWant string
+	}{
+		{"checked out", "main", true, "merge --ff-only refs/remotes/origin/main", "fetch"},
+		{"not checked out", "other", true, "fetch . refs/remotes/origin/main:refs/heads/main", "merge"},
+		{"no remote branch", "main", false, "", "merge"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &gittest.Runner{}
+			runner.On("rev-parse --abbrev-ref HEAD", tt.current+"\n", nil)
+			if !tt.remote {
+				runner.On("rev-parse --verify refs/remotes/origin/main", "", gittest.Fail("fatal: Needed a single revision"))
+			}
+
+			if err := git.New(runner, io.Discard, io.Discard).FastForwardBranch(t.Context(), "main", origin); err != nil {
+				t.Fatalf("FastForwardBranch() error: %v", err)
+			}
+			if tt.want != "" && !runner.Called(tt.want) {
+				t.Errorf("expected git %s, calls: %v", tt.want, runner.Calls())
+			}
+			if runner.Called(tt.notWant) {
+				t.Errorf("unexpected git %s, calls: %v", tt.notWant, runner.Calls())
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Runner executes git commands. Implementations must be safe for concurrent
+// use and stop the command when ctx is done.
+type Runner interface {
+	// Output runs git with args and returns its stdout.
+	Output(ctx context.Context, args ...string) (string, error)
+	// Stream runs git with args, connecting its output to stdout and stderr.
+	Stream(ctx context.Context, stdout, stderr io.Writer, args ...string) error
+}
+
+// waitDelay is how long a cancelled git process gets to exit after being
+// interrupted before it is killed
+const waitDelay = 5 * time.Second
+
+// ExecRunner runs the git binary found on PATH. Git never prompts for
+// credentials on the terminal, so a missing login fails fast instead of
+// blocking wt.
+type ExecRunner struct {
+	// Dir is the working directory for commands; empty means the current directory
+	Dir string
+}
+
+// Output runs git and returns its stdout. Failures are reported as *CommandError.
+func (r ExecRunner) Output(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := r.command(ctx, args)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), commandError(ctx, args, stderr.String(), err)
+	}
+	return stdout.String(), nil
+}
+
+// Stream runs git with its output connected to stdout and stderr. Stderr is
+// also captured so failures carry git's message.
+func (r ExecRunner) Stream(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	var captured bytes.Buffer
+	cmd := r.command(ctx, args)
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &captured)
+	if err := cmd.Run(); err != nil {
+		return commandError(ctx, args, captured.String(), err)
+	}
+	return nil
+}
+
+func (r ExecRunner) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	// Let git clean up (e.g. remove lock files) before resorting to SIGKILL
+	setCancel(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// commandError builds the error for a failed command, blaming the context
+// when it was cancelled or timed out
+func commandError(ctx context.Context, args []string, stderr string, err error) *CommandError {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return &CommandError{Args: args, Stderr: stderr, Err: err}
+}
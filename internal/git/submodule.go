@@ -0,0 +1,89 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Submodule is a submodule declared in .gitmodules
+type Submodule struct {
+	// Name identifies the submodule; its repository lives in
+	// modules/<name> under the git directory
+	Name string
+	// Path is where it is checked out, relative to the worktree root
+	Path string
+}
+
+// Submodules returns the submodules declared in the .gitmodules of the
+// worktree at dir
+func (r *Repo) Submodules(ctx context.Context, dir string) ([]Submodule, error) {
+	output, err := r.run(ctx, r.Timeout, "-C", dir, "config", "-z", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		// git config exits 1 when no key matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+
+	var submodules []Submodule
+	for _, entry := range strings.Split(output, "\x00") {
+		key, path, ok := strings.Cut(entry, "\n")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		submodules = append(submodules, Submodule{Name: name, Path: path})
+	}
+	return submodules, nil
+}
+
+// UpdateSubmodule initializes and checks out the submodule at path in the
+// worktree at dir. A non-empty reference names a local repository to copy
+// objects from instead of fetching them again; the submodule doesn't stay
+// linked to it, so it survives the reference being removed or pruned.
+func (r *Repo) UpdateSubmodule(ctx context.Context, dir, path, reference string) error {
+	args := []string{"-C", dir, "submodule", "update", "--init"}
+	if reference != "" {
+		args = append(args, "--reference", reference, "--dissociate")
+	}
+	args = append(args, "--", path)
+	if err := r.stream(ctx, r.FetchTimeout, args...); err != nil {
+		return fmt.Errorf("failed to update submodule %s: %w", path, err)
+	}
+	return nil
+}
+
+// UpdateSubmodules initializes and checks out every submodule of the
+// worktree at dir, including nested ones
+func (r *Repo) UpdateSubmodules(ctx context.Context, dir string) error {
+	if err := r.stream(ctx, r.FetchTimeout, "-C", dir, "submodule", "update", "--init", "--recursive"); err != nil {
+		return fmt.Errorf("failed to update submodules: %w", err)
+	}
+	return nil
+}
+
+// UnpushedSubmodules returns the paths of the checked-out submodules of the
+// worktree at dir, nested ones included, whose HEAD has commits that none
+// of their remotes has
+func (r *Repo) UnpushedSubmodules(ctx context.Context, dir string) ([]string, error) {
+	output, err := r.run(ctx, r.Timeout, "-C", dir, "submodule", "foreach", "--quiet", "--recursive",
+		`echo "$(git rev-list --count HEAD --not --remotes) $displaypath"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check submodules of %s: %w", dir, err)
+	}
+
+	var paths []string
+	for line := range strings.Lines(output) {
+		count, path, ok := strings.Cut(strings.TrimRight(line, "\n"), " ")
+		if n, err := strconv.Atoi(count); ok && err == nil && n > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,71 @@
+// Package mux runs agents in terminal multiplexer windows, so they outlive
+// the wt command that started them and can be switched between.
+package mux
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Backend names, as used in wt.mux
+const (
+	// Direct runs the agent in wt's own terminal; it is not a Multiplexer
+	Direct = "direct"
+	Tmux   = "tmux"
+	Zellij = "zellij"
+)
+
+// Multiplexer opens one named window (or multiplexer session) per wt session
+type Multiplexer interface {
+	// Open starts argv in a new window called name, in directory dir
+	Open(ctx context.Context, name, dir string, argv []string) error
+	// Alive reports whether the window called name exists
+	Alive(ctx context.Context, name string) bool
+	// Attach returns the command that brings the window to the foreground,
+	// to be run with the terminal's standard streams
+	Attach(name string) *exec.Cmd
+	// Kill closes the window and whatever runs in it
+	Kill(ctx context.Context, name string) error
+}
+
+// New returns the Multiplexer for backend, or nil for Direct
+func New(backend string) (Multiplexer, error) {
+	switch backend {
+	case "", Direct:
+		return nil, nil
+	case Tmux:
+		return &TmuxMux{Run: run}, nil
+	case Zellij:
+		return &ZellijMux{Run: run}, nil
+	default:
+		return nil, fmt.Errorf("unknown multiplexer %q: want direct, tmux or zellij", backend)
+	}
+}
+
+// WindowName returns a window name for the session whose worktree directory
+// is called dirName, using only characters every backend accepts
+func WindowName(dirName string) string {
+	return "wt-" + strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', ' ', '/':
+			return '_'
+		}
+		return r
+	}, dirName)
+}
+
+// runFunc runs a multiplexer command and returns its combined output
+type runFunc func(ctx context.Context, name string, args ...string) (string, error)
+
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return string(out), fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+		}
+		return string(out), fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,100 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recorder fakes a multiplexer binary, failing commands that start with fail
+type recorder struct {
+	calls []string
+	out   string
+	fail  string
+}
+
+func (r *recorder) run(ctx context.Context, name string, args ...string) (string, error) {
+	call := strings.Join(append([]string{name}, args...), " ")
+	r.calls = append(r.calls, call)
+	if r.fail != "" && strings.HasPrefix(call, r.fail) {
+		return "", errors.New("failed")
+	}
+	return r.out, nil
+}
+
+func TestNew(t *testing.T) {
+	for backend, want := range map[string]bool{"": false, Direct: false, Tmux: true, Zellij: true} {
+		m, err := New(backend)
+		if err != nil || (m != nil) != want {
+			t.Errorf("New(%q) = %v, %v", backend, m, err)
+		}
+	}
+	if _, err := New("screen"); err == nil {
+		t.Error("New(screen) should fail")
+	}
+}
+
+func TestWindowName(t *testing.T) {
+	if got := WindowName("my.repo-feat:x"); got != "wt-my_repo-feat_x" {
+		t.Errorf("WindowName() = %q", got)
+	}
+}
+
+func TestTmux(t *testing.T) {
+	r := &recorder{fail: "tmux has-session -t =wt-gone"}
+	tmux := &TmuxMux{Run: r.run}
+
+	if err := tmux.Open(t.Context(), "wt-a", "/w/a", []string{"sh", "-c", "claude"}); err != nil {
+		t.Fatal(err)
+	}
+	if !tmux.Alive(t.Context(), "wt-a") || tmux.Alive(t.Context(), "wt-gone") {
+		t.Error("Alive() should follow has-session")
+	}
+	if err := tmux.Kill(t.Context(), "wt-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"tmux new-session -d -s wt-a -c /w/a -- sh -c claude",
+		"tmux has-session -t =wt-a",
+		"tmux has-session -t =wt-gone",
+		"tmux kill-session -t =wt-a",
+	}
+	if !slices.Equal(r.calls, want) {
+		t.Errorf("calls = %q, want %q", r.calls, want)
+	}
+}
+
+func TestZellij(t *testing.T) {
+	r := &recorder{out: "wt-a\nwt-ab\n"}
+	zellij := &ZellijMux{Run: r.run}
+
+	if err := zellij.Open(t.Context(), "wt-a", "/w/a", []string{"claude"}); err != nil {
+		t.Fatal(err)
+	}
+	if !zellij.Alive(t.Context(), "wt-a") || zellij.Alive(t.Context(), "wt") {
+		t.Error("Alive() should match session names exactly")
+	}
+
+	want := []string{
+		"zellij attach --create-background wt-a",
+		"zellij --session wt-a run --close-on-exit --cwd /w/a -- claude",
+	}
+	if !slices.Equal(r.calls[:2], want) {
+		t.Errorf("calls = %q, want %q", r.calls[:2], want)
+	}
+}
+
+func TestZellijOpenCleansUp(t *testing.T) {
+	r := &recorder{fail: "zellij --session wt-a run"}
+	zellij := &ZellijMux{Run: r.run}
+
+	if err := zellij.Open(t.Context(), "wt-a", "/w/a", []string{"claude"}); err == nil {
+		t.Fatal("Open() should fail when the command can't be run")
+	}
+	if !slices.Contains(r.calls, "zellij kill-session wt-a") {
+		t.Errorf("the half-opened session should be killed, calls = %q", r.calls)
+	}
+}
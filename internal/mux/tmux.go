@@ -0,0 +1,42 @@
+package mux
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// TmuxMux runs each agent in its own detached tmux session
+type TmuxMux struct {
+	// Run runs tmux; replaceable in tests
+	Run runFunc
+}
+
+// Open starts argv in a detached tmux session called name
+func (t *TmuxMux) Open(ctx context.Context, name, dir string, argv []string) error {
+	args := append([]string{"new-session", "-d", "-s", name, "-c", dir, "--"}, argv...)
+	_, err := t.Run(ctx, "tmux", args...)
+	return err
+}
+
+// Alive reports whether the tmux session called name exists
+func (t *TmuxMux) Alive(ctx context.Context, name string) bool {
+	// "=" makes tmux match the name exactly rather than as a prefix
+	_, err := t.Run(ctx, "tmux", "has-session", "-t", "="+name)
+	return err == nil
+}
+
+// Attach returns the command that attaches to the tmux session called name
+func (t *TmuxMux) Attach(name string) *exec.Cmd {
+	// Inside tmux, switch the current client instead of nesting
+	if os.Getenv("TMUX") != "" {
+		return exec.Command("tmux", "switch-client", "-t", "="+name)
+	}
+	return exec.Command("tmux", "attach-session", "-t", "="+name)
+}
+
+// Kill ends the tmux session called name
+func (t *TmuxMux) Kill(ctx context.Context, name string) error {
+	_, err := t.Run(ctx, "tmux", "kill-session", "-t", "="+name)
+	return err
+}
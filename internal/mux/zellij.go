@@ -0,0 +1,60 @@
+package mux
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ZellijMux runs each agent in its own background zellij session
+type ZellijMux struct {
+	// Run runs zellij; replaceable in tests
+	Run runFunc
+}
+
+// Open creates a background zellij session called name and runs argv in it
+func (z *ZellijMux) Open(ctx context.Context, name, dir string, argv []string) error {
+	if _, err := z.Run(ctx, "zellij", "attach", "--create-background", name); err != nil {
+		return err
+	}
+	args := append([]string{"--session", name, "run", "--close-on-exit", "--cwd", dir, "--"}, argv...)
+	if _, err := z.Run(ctx, "zellij", args...); err != nil {
+		_ = z.Kill(ctx, name)
+		return err
+	}
+	return nil
+}
+
+// Alive reports whether the zellij session called name exists
+func (z *ZellijMux) Alive(ctx context.Context, name string) bool {
+	out, err := z.Run(ctx, "zellij", "list-sessions", "--short", "--no-formatting")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Attach returns the command that attaches to the zellij session called name
+func (z *ZellijMux) Attach(name string) *exec.Cmd {
+	// Inside zellij, switch sessions instead of nesting
+	if os.Getenv("ZELLIJ") != "" {
+		return exec.Command("zellij", "action", "switch-session", name)
+	}
+	return exec.Command("zellij", "attach", name)
+}
+
+// Kill ends and forgets the zellij session called name
+func (z *ZellijMux) Kill(ctx context.Context, name string) error {
+	if _, err := z.Run(ctx, "zellij", "kill-session", name); err != nil {
+		return err
+	}
+	// A killed session stays listed as exited until it's deleted
+	_, _ = z.Run(ctx, "zellij", "delete-session", name)
+	return nil
+}
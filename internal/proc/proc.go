@@ -0,0 +1,2 @@
+// Package proc inspects and controls other processes.
+package proc
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package proc
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Alive conservatively reports every process as alive where it can't be checked
+func Alive(pid int) bool {
+	return pid > 0
+}
+
+// Detach does nothing where processes can't be moved to a new session
+func Detach(cmd *exec.Cmd) {}
+
+// Terminate kills the process
+func Terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
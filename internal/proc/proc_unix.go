@@ -0,0 +1,38 @@
+//go:build unix
+
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Alive reports whether a process with the given PID exists
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	// EPERM: it exists but belongs to someone else
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Detach makes cmd run in a new session, without a controlling terminal, so
+// it keeps running after wt exits and doesn't get the terminal's signals
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// Terminate asks a process started with Detach, and everything it started,
+// to exit
+func Terminate(pid int) error {
+	if pid <= 0 {
+		return nil
+	}
+	// A detached process leads its own process group
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err == nil || !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
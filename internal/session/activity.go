@@ -0,0 +1,71 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LastActivity estimates when the session was last worked in: the latest of
+// its creation, its last resume, its agent's run files, and the worktree's
+// git index and HEAD log, which change as files are staged and committed
+func (m *Manager) LastActivity(s *Session) time.Time {
+	latest := s.Meta.CreatedAt
+	if s.Meta.ResumedAt.After(latest) {
+		latest = s.Meta.ResumedAt
+	}
+
+	for _, path := range m.activityFiles(s) {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// ActivityStamp cheaply summarizes the state of the files LastActivity looks
+// at, the session's metadata and the top of its worktree. It changes when
+// the session is worked in, so that a caller polling sessions can skip
+// asking git about those whose stamp is the same as last time.
+func (m *Manager) ActivityStamp(s *Session) string {
+	paths := append(m.activityFiles(s), filepath.Join(m.StateDir(s.Path), metadataFile), s.Path)
+	var b strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%d:%d ", info.ModTime().UnixNano(), info.Size())
+		} else {
+			b.WriteString("- ")
+		}
+	}
+	return b.String()
+}
+
+// activityFiles returns the agent's run files and the worktree's git index
+// and HEAD log
+func (m *Manager) activityFiles(s *Session) []string {
+	files := m.RunFiles(s.Path)
+	paths := []string{files.Log, files.PID, files.Exit}
+	if gitDir, ok := worktreeGitDir(s.Path); ok {
+		paths = append(paths, filepath.Join(gitDir, "index"), filepath.Join(gitDir, "logs", "HEAD"))
+	}
+	return paths
+}
+
+// worktreeGitDir returns the git directory of the linked worktree at path,
+// read from the .git file git leaves in it
+func worktreeGitDir(path string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(path, ".git"))
+	if err != nil {
+		return "", false
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", false
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(path, dir)
+	}
+	return dir, true
+}
@@ -0,0 +1,423 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+)
+
+// BaseMode selects what a new session branch starts from
+type BaseMode string
+
+const (
+	// BaseRemote branches from the source branch's remote-tracking ref,
+	// leaving the user's local branch and checkout untouched
+	BaseRemote BaseMode = "remote"
+	// BaseLocal fast-forwards the local source branch to its remote, then
+	// branches from it
+	BaseLocal BaseMode = "local"
+)
+
+// ParseBaseMode validates a base mode given on the command line or in config
+func ParseBaseMode(s string) (BaseMode, error) {
+	switch mode := BaseMode(s); mode {
+	case BaseRemote, BaseLocal:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid base %q: want remote or local", s)
+	}
+}
+
+// CreateOptions controls how a session is created
+type CreateOptions struct {
+	// Name is the session's name; if empty, one is generated from Names
+	// while the repository lock is held, so that concurrent creations
+	// never pick the same one
+	Name         string
+	Names        NameOptions
+	SourceBranch string
+	// Base selects between the remote-tracking ref and the local branch;
+	// empty means BaseRemote
+	Base BaseMode
+	// Fetch updates the source branch from its remote first
+	Fetch bool
+	// FetchInterval skips the fetch if the source branch was fetched more
+	// recently than this; zero always fetches
+	FetchInterval time.Duration
+	// Prompt is recorded in the session's metadata
+	Prompt string
+	// Tags are recorded in the session's metadata
+	Tags []string
+	// Sparse checks out only these directories, plus the files at the top
+	// level of the repository; empty checks out everything
+	Sparse []string
+	// Submodules checks out the submodules of repositories that have any
+	Submodules bool
+	// LFS is how Git LFS files are checked out; empty means LFSSmudge
+	LFS LFSPolicy
+	// LFSInclude lists the patterns of the LFS files LFSSkip downloads
+	LFSInclude []string
+}
+
+// Create creates a new session in one step
+func (m *Manager) Create(ctx context.Context, opts CreateOptions) (*Session, error) {
+	c, err := m.Begin(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Commit(); err != nil {
+		_ = c.Rollback(ctx)
+		return nil, err
+	}
+	return c.Session, nil
+}
+
+// Begin creates a new session but leaves it uncommitted, so that the caller
+// can finish setting it up and roll everything back if that fails. If Begin
+// itself fails, whatever it did is already rolled back.
+func (m *Manager) Begin(ctx context.Context, opts CreateOptions) (*Creation, error) {
+	creations, err := m.beginSessions(ctx, opts, 0)
+	if err != nil {
+		return nil, err
+	}
+	return creations[0], nil
+}
+
+// BeginBatch is Begin for count sessions, named <name>-1..<name>-N after
+// opts.Name, that start from the same commit, fetching the source branch
+// only once. Either every session is begun or, on failure, none is left
+// behind.
+func (m *Manager) BeginBatch(ctx context.Context, opts CreateOptions, count int) ([]*Creation, error) {
+	return m.beginSessions(ctx, opts, count)
+}
+
+// sessionNames returns the names of the sessions begun for name: name
+// itself, or with a count, name-1..name-N
+func sessionNames(name string, count int) []string {
+	if count == 0 {
+		return []string{name}
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", name, i+1)
+	}
+	return names
+}
+
+// beginSessions implements Begin, with a zero count, and BeginBatch
+func (m *Manager) beginSessions(ctx context.Context, opts CreateOptions, count int) ([]*Creation, error) {
+	if opts.Base == "" {
+		opts.Base = BaseRemote
+	}
+	sparse, err := CleanSparsePaths(opts.Sparse)
+	if err != nil {
+		return nil, err
+	}
+	opts.Sparse = sparse
+
+	repoName, err := m.Git.GetRepoName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Given names are checked before fetching anything, and checked again
+	// for existing sessions under the lock
+	if opts.Name != "" {
+		for _, name := range sessionNames(opts.Name, count) {
+			if err := ValidateName(name); err != nil {
+				return nil, err
+			}
+			if err := m.checkFree(repoName, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b, err := m.prepareBase(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	creations, err := m.reserve(ctx, opts, count, repoName, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// With their worktrees in place, the sessions are safe from other wt
+	// processes, so their files are filled in without holding them up
+	for _, c := range creations {
+		if err := m.fill(ctx, c, opts); err != nil {
+			for i := len(creations) - 1; i >= 0; i-- {
+				if rbErr := creations[i].Rollback(ctx); rbErr != nil {
+					m.printf("Warning: rollback incomplete: %v\n", rbErr)
+				}
+			}
+			return nil, err
+		}
+	}
+	return creations, nil
+}
+
+// checkFree fails with ErrAlreadyExists if session name has a worktree
+func (m *Manager) checkFree(repoName, name string) error {
+	worktreePath := m.WorktreePath(repoName, name)
+	if _, err := os.Stat(worktreePath); err == nil {
+		return fmt.Errorf("%w: '%s' at %s", ErrAlreadyExists, name, worktreePath)
+	}
+	return nil
+}
+
+// reserve names the sessions and creates their branches and worktrees from
+// b, under the repository lock, so concurrent wt processes can't claim the
+// same name. Creating a worktree is all the lock covers of the slow parts.
+func (m *Manager) reserve(ctx context.Context, opts CreateOptions, count int, repoName string, b base) ([]*Creation, error) {
+	unlock, err := m.lockRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Clean up after any wt that was killed while creating a session
+	if err := m.recover(ctx); err != nil {
+		return nil, err
+	}
+
+	if opts.Name == "" {
+		if opts.Name, err = m.generateName(ctx, opts.Names); err != nil {
+			return nil, err
+		}
+	}
+	names := sessionNames(opts.Name, count)
+
+	// Ensure base directory exists
+	if err := os.MkdirAll(m.BaseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create worktree base directory: %w", err)
+	}
+
+	for _, name := range names {
+		if err := m.checkFree(repoName, name); err != nil {
+			return nil, err
+		}
+	}
+
+	var creations []*Creation
+	for _, name := range names {
+		c, err := m.begin(ctx, opts, name, m.WorktreePath(repoName, name), b)
+		if err != nil {
+			for i := len(creations) - 1; i >= 0; i-- {
+				if rbErr := creations[i].Rollback(ctx); rbErr != nil {
+					m.printf("Warning: rollback incomplete: %v\n", rbErr)
+				}
+			}
+			return nil, err
+		}
+		creations = append(creations, c)
+	}
+	return creations, nil
+}
+
+// begin creates one session from b, rolling it back if that fails. The
+// caller holds the repository lock.
+func (m *Manager) begin(ctx context.Context, opts CreateOptions, name, worktreePath string, b base) (*Creation, error) {
+	c, err := m.beginCreation(ctx, name, worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.build(ctx, c, opts, name, b, worktreePath); err != nil {
+		if rbErr := c.Rollback(ctx); rbErr != nil {
+			m.printf("Warning: rollback incomplete: %v\n", rbErr)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// build performs the journaled steps of creating a session
+func (m *Manager) build(ctx context.Context, c *Creation, opts CreateOptions, name string, b base, worktreePath string) error {
+	branchName := GetBranchName(name)
+	meta := Metadata{
+		SourceBranch: opts.SourceBranch,
+		CreatedAt:    time.Now(),
+		Prompt:       opts.Prompt,
+		Tags:         opts.Tags,
+		Sparse:       opts.Sparse,
+	}
+
+	// Create branch if it doesn't exist. A pre-existing branch is not
+	// journaled, so a rollback never deletes it.
+	if !m.Git.BranchExists(ctx, branchName) {
+		meta.BaseRef = strings.TrimPrefix(b.ref, "refs/remotes/")
+		m.printf("Creating branch %s from %s...\n", branchName, meta.BaseRef)
+		// Start from the commit resolved up front, so every session of a
+		// batch starts from the same place
+		start := b.ref
+		if b.commit != "" {
+			start = b.commit
+		}
+		err := c.do(stepBranch, branchName, func() error {
+			return m.Git.CreateBranch(ctx, branchName, start)
+		})
+		if err != nil {
+			return err
+		}
+		meta.BaseMode = b.mode
+		meta.BaseCommit = b.commit
+	} else {
+		m.printf("Branch %s already exists, using existing branch\n", branchName)
+	}
+
+	// Create worktree
+	m.printf("Creating worktree at %s...\n", worktreePath)
+	if len(opts.Sparse) > 0 {
+		m.printf("Checking out only %s\n", strings.Join(opts.Sparse, ", "))
+	}
+	worktreeOpts := git.WorktreeOptions{
+		Sparse:     opts.Sparse,
+		SkipSmudge: m.skipsSmudge(ctx, opts, branchName),
+	}
+	err := c.do(stepWorktree, worktreePath, func() error {
+		return m.Git.AddWorktreeWith(ctx, worktreePath, branchName, worktreeOpts)
+	})
+	if err != nil {
+		return err
+	}
+	c.skipSmudge = worktreeOpts.SkipSmudge
+
+	if err := m.SaveMetadata(worktreePath, meta); err != nil {
+		return err
+	}
+
+	c.Session = &Session{
+		Name:   name,
+		Branch: branchName,
+		Path:   worktreePath,
+		Meta:   meta,
+	}
+	return nil
+}
+
+// fill gets the LFS files and submodules of a session built by build,
+// which may mean downloading them. The caller doesn't hold the repository
+// lock.
+func (m *Manager) fill(ctx context.Context, c *Creation, opts CreateOptions) error {
+	if c.skipSmudge {
+		if err := m.fillLFS(ctx, opts, c.Session.Path); err != nil {
+			return err
+		}
+	}
+
+	// Submodules live inside the worktree and its git directory, so rolling
+	// back the worktree removes them too
+	if opts.Submodules {
+		if err := m.updateSubmodules(ctx, c.Session.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// base is what new session branches start from
+type base struct {
+	// ref is the full ref to branch from, e.g. refs/remotes/origin/main
+	ref  string
+	mode BaseMode
+	// commit is what ref pointed to when it was prepared
+	commit string
+}
+
+// prepareBase fetches the source branch from its upstream, if allowed and
+// not fetched recently, and returns the full ref to branch from. Failures to
+// reach the remote are only warnings, so sessions can be created offline.
+// Only BaseLocal touches the local source branch.
+//
+// It holds the fetch lock rather than the repository lock, so a slow remote
+// only holds up other wt processes fetching too; once one has fetched, the
+// others usually find the branch fetched recently enough.
+func (m *Manager) prepareBase(ctx context.Context, opts CreateOptions) (base, error) {
+	unlock, err := m.lockFetch(ctx)
+	if err != nil {
+		return base{}, err
+	}
+	defer unlock()
+
+	b, err := m.baseRef(ctx, opts)
+	if err != nil {
+		return b, err
+	}
+
+	// Verify the base has commits
+	if !m.Git.HasCommits(ctx, b.ref) {
+		return b, fmt.Errorf("source branch '%s' has no commits", opts.SourceBranch)
+	}
+	b.commit, err = m.Git.ResolveCommit(ctx, b.ref)
+	return b, err
+}
+
+// baseRef fetches as prepareBase describes and picks the ref to branch from
+func (m *Manager) baseRef(ctx context.Context, opts CreateOptions) (base, error) {
+	upstream, ok, err := m.Git.GetUpstream(ctx, opts.SourceBranch)
+	if err != nil {
+		return base{}, err
+	}
+	if !ok {
+		m.printf("No remote for %s, using local branch\n", opts.SourceBranch)
+		return base{ref: opts.SourceBranch, mode: BaseLocal}, nil
+	}
+
+	if m.shouldFetch(ctx, opts, upstream) {
+		m.printf("Fetching %s...\n", upstream)
+		if err := m.Git.Fetch(ctx, upstream); err != nil {
+			// Non-fatal: the remote might be unreachable
+			m.printf("Warning: %v\n", err)
+		}
+	}
+	// A Ctrl-C during the fetch is only reported as a warning above
+	if err := ctx.Err(); err != nil {
+		return base{}, err
+	}
+
+	if opts.Base == BaseLocal {
+		m.printf("Updating %s...\n", opts.SourceBranch)
+		if err := m.Git.FastForwardBranch(ctx, opts.SourceBranch, upstream); err != nil {
+			// Non-fatal: might not be fast-forwardable
+			m.printf("Warning: %v\n", err)
+		}
+		return base{ref: opts.SourceBranch, mode: BaseLocal}, nil
+	}
+
+	if !m.Git.HasCommits(ctx, upstream.TrackingRef()) {
+		m.printf("%s not found, using local branch %s\n", upstream, opts.SourceBranch)
+		return base{ref: opts.SourceBranch, mode: BaseLocal}, nil
+	}
+
+	// Local work that isn't pushed won't be in the session; say so
+	if n, err := m.Git.CountCommits(ctx, upstream.TrackingRef(), opts.SourceBranch); err == nil && n > 0 {
+		m.printf("Note: %s has %d commit(s) not in %s; use --base local to include them\n", opts.SourceBranch, n, upstream)
+	}
+	return base{ref: upstream.TrackingRef(), mode: BaseRemote}, nil
+}
+
+// shouldFetch reports whether upstream needs fetching, explaining why not
+func (m *Manager) shouldFetch(ctx context.Context, opts CreateOptions, upstream git.Upstream) bool {
+	if !opts.Fetch {
+		m.printf("Skipping fetch of %s (offline)\n", upstream)
+		return false
+	}
+	if opts.FetchInterval <= 0 {
+		return true
+	}
+
+	fetched, ok, err := m.Git.LastFetched(ctx, upstream)
+	if err != nil || !ok {
+		return true
+	}
+	if age := time.Since(fetched); age < opts.FetchInterval {
+		m.printf("Skipping fetch of %s (fetched %s ago)\n", upstream, age.Round(time.Second))
+		return false
+	}
+	return true
+}
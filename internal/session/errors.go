@@ -0,0 +1,95 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no session matches a name
+	ErrNotFound = errors.New("session not found")
+	// ErrAmbiguous is matched by AmbiguousError
+	ErrAmbiguous = errors.New("ambiguous session name")
+	// ErrInvalidName is returned when creating a session with a name that
+	// ValidateName rejects
+	ErrInvalidName = errors.New("invalid session name")
+	// ErrAlreadyExists is returned when creating a session whose worktree exists
+	ErrAlreadyExists = errors.New("session already exists")
+	// ErrAgentRunning is returned when an agent is already working in a session
+	ErrAgentRunning = errors.New("an agent is already running in the session")
+	// ErrLocked is returned when another wt process holds the repository lock too long
+	ErrLocked = errors.New("repository is locked by another wt process")
+	// ErrNotSparse is returned when widening the checkout of a session that
+	// already has every directory
+	ErrNotSparse = errors.New("session has a full checkout")
+	// ErrUnpushedSubmodule is returned when removing a session would lose
+	// commits made in one of its submodules
+	ErrUnpushedSubmodule = errors.New("submodule has unpushed commits")
+)
+
+// AmbiguousError is returned when a name matches more than one session
+type AmbiguousError struct {
+	Query   string
+	Matches []Session
+	// LastUsed[i] is when Matches[i] was last active, zero if unknown
+	LastUsed []time.Time
+}
+
+// Error lists the matching sessions with their branches and when they were
+// last used, so the user can tell them apart
+func (e *AmbiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "'%s' matches multiple sessions:\n", e.Query)
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for i, m := range e.Matches {
+		used := "never used"
+		if i < len(e.LastUsed) && !e.LastUsed[i].IsZero() {
+			used = "last used " + e.LastUsed[i].Format("Jan 2 15:04")
+		}
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\n", m.Name, m.Branch, used)
+	}
+	_ = w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Is makes errors.Is(err, ErrAmbiguous) report true
+func (e *AmbiguousError) Is(target error) bool {
+	return target == ErrAmbiguous
+}
+
+// LooseMatchError is returned by FindStrict when a name matches a session
+// only by a substring, a tag, its letters in order or its prompt
+type LooseMatchError struct {
+	Query   string
+	Session Session
+}
+
+func (e *LooseMatchError) Error() string {
+	return fmt.Sprintf("'%s' only loosely matches session '%s'; give its name to be sure", e.Query, e.Session.Name)
+}
+
+// Is makes errors.Is(err, ErrNotFound) report true, as no session is
+// certainly meant
+func (e *LooseMatchError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// SkippedError is returned by RemoveAll when some sessions were not removed.
+// It wraps the reason for each, so errors.Is tells why.
+type SkippedError struct {
+	Names []string
+	Errs  []error
+	// Total is the number of sessions RemoveAll tried to remove
+	Total int
+}
+
+func (e *SkippedError) Error() string {
+	return fmt.Sprintf("%d of %d sessions not removed: %s", len(e.Names), e.Total, strings.Join(e.Names, ", "))
+}
+
+func (e *SkippedError) Unwrap() []error {
+	return e.Errs
+}
@@ -0,0 +1,287 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name generators for sessions created without a name
+const (
+	// NamesTimestamp names sessions after when they were created,
+	// e.g. 20241215-143022
+	NamesTimestamp = "timestamp"
+	// NamesMemorable picks an adjective-noun pair, e.g. brave-otter
+	NamesMemorable = "memorable"
+	// NamesPrompt uses the issue key mentioned in the prompt, or the
+	// prompt's first words, e.g. proj-123 or fix-the-login-bug
+	NamesPrompt = "prompt"
+	// NamesCounter numbers sessions per repository: session-1, session-2...
+	NamesCounter = "counter"
+	// NamesTemplate fills in a template such as {user}-{date}-{n}
+	NamesTemplate = "template"
+)
+
+// maxNameAttempts bounds the search for a name nothing else uses
+const maxNameAttempts = 100
+
+// NameOptions controls GenerateName
+type NameOptions struct {
+	// Generator is one of the Names* constants; empty means NamesTimestamp
+	Generator string
+	// Template is filled in by NamesTemplate. It may use {user}, {repo},
+	// {branch}, {date}, {time}, {n}, {prompt} and {words}.
+	Template string
+	// Prompt is the session's initial instruction, if any
+	Prompt string
+	// SourceBranch is the branch the session will start from
+	SourceBranch string
+}
+
+// GenerateName makes up a name for a new session that no existing session,
+// worktree or wt- branch uses. Only a counted name is reserved, by moving
+// the counter on; to create the session under the same name without a race,
+// leave CreateOptions.Name empty instead.
+func (m *Manager) GenerateName(ctx context.Context, opts NameOptions) (string, error) {
+	unlock, err := m.lockRepo(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	return m.generateName(ctx, opts)
+}
+
+// generateName implements GenerateName; the caller holds the repository
+// lock
+func (m *Manager) generateName(ctx context.Context, opts NameOptions) (string, error) {
+	repoName, err := m.Git.GetRepoName(ctx)
+	if err != nil {
+		return "", err
+	}
+	sessions, err := m.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	taken := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		taken[s.Name] = true
+	}
+
+	now := time.Now()
+	var candidate func(attempt, n int) (string, error)
+	counted := false
+	switch opts.Generator {
+	case "", NamesTimestamp:
+		candidate = suffixed(now.Format(timestampFormat))
+	case NamesMemorable:
+		candidate = func(attempt, _ int) (string, error) {
+			name := memorableName()
+			// Running out of fresh pairs is unlikely; numbering them isn't
+			if attempt >= maxNameAttempts/2 {
+				name += "-" + strconv.Itoa(attempt)
+			}
+			return name, nil
+		}
+	case NamesPrompt:
+		base := promptName(opts.Prompt)
+		if base == "" {
+			base = now.Format(timestampFormat)
+		}
+		candidate = suffixed(base)
+	case NamesCounter:
+		counted = true
+		candidate = func(_, n int) (string, error) { return "session-" + strconv.Itoa(n), nil }
+	case NamesTemplate:
+		counted = strings.Contains(opts.Template, "{n}")
+		fields := templateFields(repoName, opts, now)
+		candidate = func(attempt, n int) (string, error) {
+			name, err := fillTemplate(opts.Template, fields, n)
+			if err != nil || counted {
+				return name, err
+			}
+			return suffixed(name)(attempt, n)
+		}
+	default:
+		return "", fmt.Errorf("unknown name generator %q", opts.Generator)
+	}
+
+	next := 1
+	if counted {
+		if next, err = m.lastCount(ctx); err != nil {
+			return "", err
+		}
+		next++
+	}
+	for attempt := range maxNameAttempts {
+		name, err := candidate(attempt, next+attempt)
+		if err != nil {
+			return "", err
+		}
+		if err := ValidateName(name); err != nil {
+			return "", fmt.Errorf("generated %w", err)
+		}
+		if taken[name] || m.Git.BranchExists(ctx, GetBranchName(name)) {
+			continue
+		}
+		if _, err := os.Stat(m.WorktreePath(repoName, name)); err == nil {
+			continue
+		}
+		if counted {
+			if err := m.saveCount(ctx, next+attempt); err != nil {
+				return "", err
+			}
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("failed to find an unused session name after %d attempts", maxNameAttempts)
+}
+
+// suffixed returns candidates base, base-2, base-3...
+func suffixed(base string) func(attempt, n int) (string, error) {
+	return func(attempt, _ int) (string, error) {
+		if attempt == 0 {
+			return base, nil
+		}
+		return fmt.Sprintf("%s-%d", base, attempt+1), nil
+	}
+}
+
+var (
+	adjectives = []string{
+		"agile", "amber", "bold", "brave", "bright", "calm", "clever", "cosmic",
+		"crisp", "eager", "fancy", "fierce", "gentle", "golden", "happy", "hidden",
+		"jolly", "keen", "lively", "lucky", "mellow", "misty", "nimble", "noble",
+		"proud", "quick", "quiet", "rapid", "rusty", "shiny", "silent", "sleek",
+		"snowy", "steady", "sunny", "swift", "tidy", "vivid", "witty", "zesty",
+	}
+	nouns = []string{
+		"badger", "beacon", "cedar", "comet", "coral", "crane", "delta", "ember",
+		"falcon", "fern", "fox", "glacier", "harbor", "heron", "island", "lark",
+		"lynx", "maple", "meadow", "moose", "nebula", "otter", "owl", "panda",
+		"pebble", "pine", "quartz", "raven", "river", "sparrow", "summit", "tiger",
+		"tulip", "valley", "walrus", "willow", "wolf", "yak", "zebra", "zephyr",
+	}
+)
+
+// memorableName returns a random adjective-noun pair
+func memorableName() string {
+	return adjectives[rand.IntN(len(adjectives))] + "-" + nouns[rand.IntN(len(nouns))]
+}
+
+// issueKey matches issue references such as PROJ-123 or #123
+var issueKey = regexp.MustCompile(`\b([A-Z][A-Z0-9]+-[0-9]+)\b|#([0-9]+)\b`)
+
+// promptWords is how many words of a prompt make its name
+const promptWords = 5
+
+// promptName names a session after the issue its prompt mentions, or the
+// prompt's first few words; it's empty if the prompt offers nothing usable
+func promptName(prompt string) string {
+	if m := issueKey.FindStringSubmatch(prompt); m != nil {
+		if m[1] != "" {
+			return strings.ToLower(m[1])
+		}
+		return "issue-" + m[2]
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	words := strings.Fields(strings.ReplaceAll(line, "/", " "))
+	return Slugify(strings.Join(words[:min(len(words), promptWords)], " "))
+}
+
+// templateFields returns the values of the placeholders a template may use,
+// except {n}
+func templateFields(repoName string, opts NameOptions, now time.Time) map[string]string {
+	username := os.Getenv("USER")
+	if u, err := user.Current(); username == "" && err == nil {
+		username = u.Username
+	}
+	return map[string]string{
+		"user":   Slugify(filepath.Base(username)),
+		"repo":   Slugify(repoName),
+		"branch": Slugify(opts.SourceBranch),
+		"date":   now.Format("20060102"),
+		"time":   now.Format("150405"),
+		"prompt": promptName(opts.Prompt),
+		"words":  memorableName(),
+	}
+}
+
+var (
+	// placeholder matches {field} in a name template
+	placeholder = regexp.MustCompile(`\{([a-z]*)\}`)
+	dashes      = regexp.MustCompile(`-{2,}`)
+)
+
+// fillTemplate replaces the placeholders in template with fields, and {n}
+// with n
+func fillTemplate(template string, fields map[string]string, n int) (string, error) {
+	if template == "" {
+		return "", errors.New("wt.names is template, but wt.nameTemplate is not set")
+	}
+	var unknown string
+	name := placeholder.ReplaceAllStringFunc(template, func(p string) string {
+		field := p[1 : len(p)-1]
+		if field == "n" {
+			return strconv.Itoa(n)
+		}
+		value, ok := fields[field]
+		if !ok && unknown == "" {
+			unknown = p
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in name template %q", unknown, template)
+	}
+	// Empty fields, such as {prompt} without a prompt, leave stray dashes
+	return strings.Trim(dashes.ReplaceAllString(name, "-"), "-"), nil
+}
+
+// counterPath returns the file holding the last number NamesCounter and
+// {n} handed out in this repository
+func (m *Manager) counterPath(ctx context.Context) (string, error) {
+	repoName, err := m.Git.GetRepoName(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(m.BaseDir, StateDirName, repoName+".counter"), nil
+}
+
+// lastCount returns the last number handed out, or 0
+func (m *Manager) lastCount(ctx context.Context) (int, error) {
+	path, err := m.counterPath(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := readInt(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read session counter: %w", err)
+	}
+	return n, nil
+}
+
+// saveCount records n as the last number handed out
+func (m *Manager) saveCount(ctx context.Context, n int) error {
+	path, err := m.counterPath(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save session counter: %w", err)
+	}
+	if err := writeFileAtomic(path, []byte(strconv.Itoa(n)+"\n")); err != nil {
+		return fmt.Errorf("failed to save session counter: %w", err)
+	}
+	return nil
+}
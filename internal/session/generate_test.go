@@ -0,0 +1,104 @@
+package session
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPromptName(t *testing.T) {
+	tests := map[string]string{
+		"Fix PROJ-123: login fails":                  "proj-123",
+		"See #42 for details":                        "issue-42",
+		"Fix the login bug on mobile and desktop\nx": "fix-the-login-bug-on",
+		"":    "",
+		"!!!": "",
+	}
+	for prompt, want := range tests {
+		if got := promptName(prompt); got != want {
+			t.Errorf("promptName(%q) = %q, want %q", prompt, got, want)
+		}
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	fields := map[string]string{"user": "ana", "date": "20260102", "prompt": ""}
+
+	got, err := fillTemplate("{user}-{date}-{n}", fields, 7)
+	if err != nil || got != "ana-20260102-7" {
+		t.Errorf("fillTemplate() = %q, %v; want ana-20260102-7", got, err)
+	}
+	if got, _ := fillTemplate("{prompt}-{user}", fields, 1); got != "ana" {
+		t.Errorf("empty fields should leave no stray dashes, got %q", got)
+	}
+	if _, err := fillTemplate("{user}-{nope}", fields, 1); err == nil || !strings.Contains(err.Error(), "{nope}") {
+		t.Errorf("fillTemplate() with an unknown placeholder error = %v", err)
+	}
+}
+
+func TestGenerateNameAvoidsCollisions(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "fix-the-bug")
+	runner.On("rev-parse --verify", "", errors.New("unknown revision"))
+	// A branch left over from an old session
+	runner.On("rev-parse --verify wt-fix-the-bug-2", "abc\n", nil)
+
+	name, err := m.GenerateName(t.Context(), NameOptions{Generator: NamesPrompt, Prompt: "Fix the bug"})
+	if err != nil {
+		t.Fatalf("GenerateName() error: %v", err)
+	}
+	if name != "fix-the-bug-3" {
+		t.Errorf("GenerateName() = %q, want fix-the-bug-3", name)
+	}
+}
+
+func TestGenerateNameCounter(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "session-2")
+	runner.On("rev-parse --verify", "", errors.New("unknown revision"))
+
+	var names []string
+	for range 3 {
+		name, err := m.GenerateName(t.Context(), NameOptions{Generator: NamesCounter})
+		if err != nil {
+			t.Fatalf("GenerateName() error: %v", err)
+		}
+		names = append(names, name)
+	}
+	if want := "session-1 session-3 session-4"; strings.Join(names, " ") != want {
+		t.Errorf("GenerateName() gave %v, want %s", names, want)
+	}
+}
+
+func TestGenerateNameGenerators(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner)
+	runner.On("rev-parse --verify", "", errors.New("unknown revision"))
+	t.Setenv("USER", "Ana.Lee")
+
+	tests := []struct {
+		opts NameOptions
+		want string
+	}{
+		{NameOptions{}, `^\d{8}-\d{6}$`},
+		{NameOptions{Generator: NamesMemorable}, `^[a-z]+-[a-z]+$`},
+		{NameOptions{Generator: NamesPrompt}, `^\d{8}-\d{6}$`},
+		{NameOptions{Generator: NamesTemplate, Template: "{user}/{branch}-{n}", SourceBranch: "feature/x"}, `^ana-lee/feature/x-1$`},
+		{NameOptions{Generator: NamesTemplate, Template: "{repo}-{words}"}, `^myrepo-[a-z]+-[a-z]+$`},
+	}
+	for _, tt := range tests {
+		name, err := m.GenerateName(t.Context(), tt.opts)
+		if err != nil {
+			t.Errorf("GenerateName(%+v) error: %v", tt.opts, err)
+			continue
+		}
+		if !regexp.MustCompile(tt.want).MatchString(name) {
+			t.Errorf("GenerateName(%+v) = %q, want a match for %s", tt.opts, name, tt.want)
+		}
+	}
+
+	if _, err := m.GenerateName(t.Context(), NameOptions{Generator: NamesTemplate, Template: "a b"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("GenerateName() from a template giving an invalid name error = %v, want ErrInvalidName", err)
+	}
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// historyLimit is how many recently used sessions are remembered
+const historyLimit = 20
+
+// historyPath returns the file recording which of this repository's
+// sessions were used most recently
+func (m *Manager) historyPath(ctx context.Context) (string, error) {
+	repoName, err := m.Git.GetRepoName(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(m.BaseDir, StateDirName, repoName+".history.json"), nil
+}
+
+// History returns the names of the repository's recently used sessions,
+// most recent first. Some may have been removed since.
+func (m *Manager) History(ctx context.Context) ([]string, error) {
+	path, err := m.historyPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session history: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse session history %s: %w", path, err)
+	}
+	return names, nil
+}
+
+// RecordUse notes that the session name was just resumed or entered, for
+// the - and @prev selectors
+func (m *Manager) RecordUse(ctx context.Context, name string) error {
+	return m.updateHistory(ctx, func(names []string) []string {
+		names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+		return append([]string{name}, names[:min(len(names), historyLimit-1)]...)
+	})
+}
+
+// forget drops a removed session from the history, so a new session of the
+// same name doesn't inherit its place
+func (m *Manager) forget(ctx context.Context, name string) error {
+	return m.updateHistory(ctx, func(names []string) []string {
+		return slices.DeleteFunc(names, func(n string) bool { return n == name })
+	})
+}
+
+func (m *Manager) updateHistory(ctx context.Context, update func([]string) []string) error {
+	names, err := m.History(ctx)
+	if err != nil {
+		// Start over rather than fail because of a damaged history
+		names = nil
+	}
+	path, err := m.historyPath(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(update(names))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to record session use: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to record session use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/emilrex/wt/internal/proc"
+)
+
+const journalFile = "journal.json"
+
+// stepKind is something creating a session can leave behind
+type stepKind string
+
+const (
+	stepBranch   stepKind = "branch"
+	stepWorktree stepKind = "worktree"
+	// stepPath is a file or directory created in or for the session
+	stepPath stepKind = "path"
+)
+
+// step is one journaled action. A step is recorded before it runs, so a step
+// that isn't Done may still have partially happened.
+type step struct {
+	Kind   stepKind `json:"kind"`
+	Target string   `json:"target"`
+	Done   bool     `json:"done"`
+}
+
+// journal is the on-disk record of a creation in progress
+type journal struct {
+	Session  string `json:"session"`
+	RepoRoot string `json:"repo_root"`
+	PID      int    `json:"pid"`
+	Steps    []step `json:"steps"`
+}
+
+// Creation is a session being created. Every step is journaled in the
+// session's state directory before it runs, so that Rollback (or Recover,
+// after a crash) undoes exactly what this creation did and nothing that
+// existed before. Until Commit, the session is not considered complete.
+type Creation struct {
+	Session *Session
+
+	m        *Manager
+	stateDir string
+	journal  journal
+	// skipSmudge is set when the checkout left LFS files for fill
+	skipSmudge bool
+}
+
+// beginCreation starts the journal for a new session
+func (m *Manager) beginCreation(ctx context.Context, name, worktreePath string) (*Creation, error) {
+	root, err := m.Git.GetRepoRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Creation{
+		m:        m,
+		stateDir: m.StateDir(worktreePath),
+		journal:  journal{Session: name, RepoRoot: root, PID: os.Getpid()},
+	}
+	if err := os.MkdirAll(c.stateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session state directory: %w", err)
+	}
+	if err := c.save(); err != nil {
+		_ = os.RemoveAll(c.stateDir)
+		return nil, err
+	}
+	return c, nil
+}
+
+// TrackPath runs fn, which creates path for the session, and removes path
+// if the creation is rolled back
+func (c *Creation) TrackPath(path string, fn func() error) error {
+	return c.do(stepPath, path, fn)
+}
+
+// do journals a step, runs it and marks it done
+func (c *Creation) do(kind stepKind, target string, fn func() error) error {
+	c.journal.Steps = append(c.journal.Steps, step{Kind: kind, Target: target})
+	if err := c.save(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	c.journal.Steps[len(c.journal.Steps)-1].Done = true
+	return c.save()
+}
+
+// Commit marks the session as complete; it can no longer be rolled back
+func (c *Creation) Commit() error {
+	if err := os.Remove(filepath.Join(c.stateDir, journalFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to complete session creation: %w", err)
+	}
+	return nil
+}
+
+// Rollback undoes every step taken so far, in reverse order. It keeps going
+// after failures and runs even if ctx was cancelled.
+func (c *Creation) Rollback(ctx context.Context) error {
+	c.m.printf("Rolling back session '%s'...\n", c.journal.Session)
+	return c.m.undo(context.WithoutCancel(ctx), c.journal, c.stateDir)
+}
+
+func (c *Creation) save() error {
+	data, err := json.MarshalIndent(c.journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(c.stateDir, journalFile), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write creation journal: %w", err)
+	}
+	return nil
+}
+
+// undo reverses the steps of j, then removes the session's state directory
+func (m *Manager) undo(ctx context.Context, j journal, stateDir string) error {
+	var errs []error
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		s := j.Steps[i]
+		switch s.Kind {
+		case stepWorktree:
+			// A half-added worktree may not be removable by git; clear
+			// what's left and let git forget it
+			if err := m.Git.RemoveWorktree(ctx, s.Target); err != nil {
+				_ = os.RemoveAll(s.Target)
+				_ = m.Git.PruneWorktrees(ctx)
+			}
+		case stepBranch:
+			if err := m.Git.DeleteBranch(ctx, s.Target); err != nil && s.Done {
+				errs = append(errs, err)
+			}
+		case stepPath:
+			if err := os.RemoveAll(s.Target); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := os.RemoveAll(stateDir); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Recover rolls back creations of this repository's sessions that never
+// completed because wt was killed or crashed. Creations still in progress
+// in another wt process are left alone.
+func (m *Manager) Recover(ctx context.Context) error {
+	unlock, err := m.lockRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.recover(ctx)
+}
+
+// recover implements Recover; the caller holds the repository lock
+func (m *Manager) recover(ctx context.Context) error {
+	root, err := m.Git.GetRepoRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(m.BaseDir, StateDirName, "*", journalFile))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var j journal
+		if err := json.Unmarshal(data, &j); err != nil {
+			m.printf("Warning: ignoring unreadable journal %s: %v\n", path, err)
+			continue
+		}
+		if j.RepoRoot != root || proc.Alive(j.PID) {
+			continue
+		}
+
+		m.printf("Rolling back interrupted creation of session '%s'...\n", j.Session)
+		if err := m.undo(ctx, j, filepath.Dir(path)); err != nil {
+			m.printf("Warning: %v\n", err)
+		}
+	}
+	return nil
+}
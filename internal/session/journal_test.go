@@ -0,0 +1,130 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// deadPID is a process ID that is never in use
+const deadPID = 1 << 30
+
+// writeJournal leaves a creation journal behind as a killed wt would
+func writeJournal(t *testing.T, m *Manager, name string, j journal) string {
+	t.Helper()
+	dir := m.StateDir(m.WorktreePath("myrepo", name))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, journalFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCreateWorktreeFailureKeepsExistingBranch(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("worktree add", "", errors.New("fatal: disk full"))
+
+	if _, err := m.Create(t.Context(), createOpts("feature")); err == nil {
+		t.Fatal("Create() should fail")
+	}
+	if runner.Called("branch -D") {
+		t.Errorf("pre-existing branch must not be deleted, calls: %v", runner.Calls())
+	}
+	if _, err := os.Stat(m.StateDir(m.WorktreePath("myrepo", "feature"))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state directory should be rolled back: %v", err)
+	}
+}
+
+func TestBeginRollback(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+
+	c, err := m.Begin(t.Context(), createOpts("feature"))
+	if err != nil {
+		t.Fatalf("Begin() error: %v", err)
+	}
+	extra := filepath.Join(c.Session.Path, "node_modules")
+	if err := c.TrackPath(extra, func() error { return os.MkdirAll(extra, 0755) }); err != nil {
+		t.Fatalf("TrackPath() error: %v", err)
+	}
+
+	if err := c.Rollback(t.Context()); err != nil {
+		t.Fatalf("Rollback() error: %v", err)
+	}
+	for _, call := range []string{"worktree remove --force " + c.Session.Path, "branch -D wt-feature"} {
+		if !runner.Called(call) {
+			t.Errorf("expected git %s, calls: %v", call, runner.Calls())
+		}
+	}
+	if _, err := os.Stat(extra); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("tracked path should be removed: %v", err)
+	}
+	if _, err := os.Stat(m.StateDir(c.Session.Path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state directory should be removed: %v", err)
+	}
+}
+
+func TestBeginCommit(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	c, err := m.Begin(t.Context(), createOpts("feature"))
+	if err != nil {
+		t.Fatalf("Begin() error: %v", err)
+	}
+	journalPath := filepath.Join(m.StateDir(c.Session.Path), journalFile)
+	if _, err := os.Stat(journalPath); err != nil {
+		t.Fatalf("journal should exist until commit: %v", err)
+	}
+
+	if err := c.Commit(); err != nil {
+		t.Fatalf("Commit() error: %v", err)
+	}
+	if _, err := os.Stat(journalPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal should be removed on commit: %v", err)
+	}
+	if meta, err := m.LoadMetadata(c.Session.Path); err != nil || meta.SourceBranch != "main" {
+		t.Errorf("metadata should survive commit: %+v, %v", meta, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	m, runner := newTestManager(t)
+	path := m.WorktreePath("myrepo", "crashed")
+	crashed := writeJournal(t, m, "crashed", journal{
+		Session:  "crashed",
+		RepoRoot: "/src/myrepo",
+		PID:      deadPID,
+		Steps: []step{
+			{Kind: stepBranch, Target: "wt-crashed", Done: true},
+			{Kind: stepWorktree, Target: path},
+		},
+	})
+	running := writeJournal(t, m, "running", journal{Session: "running", RepoRoot: "/src/myrepo", PID: os.Getpid()})
+	other := writeJournal(t, m, "other", journal{Session: "other", RepoRoot: "/src/other", PID: deadPID})
+
+	if err := m.Recover(t.Context()); err != nil {
+		t.Fatalf("Recover() error: %v", err)
+	}
+
+	for _, call := range []string{"worktree remove --force " + path, "branch -D wt-crashed"} {
+		if !runner.Called(call) {
+			t.Errorf("expected git %s, calls: %v", call, runner.Calls())
+		}
+	}
+	if _, err := os.Stat(crashed); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("crashed creation should be cleaned up: %v", err)
+	}
+	for _, dir := range []string{running, other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s should be left alone: %v", dir, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// LFSPolicy selects how a new session gets the content of Git LFS files
+type LFSPolicy string
+
+const (
+	// LFSSmudge lets Git LFS download every file during the checkout, as a
+	// plain git checkout would
+	LFSSmudge LFSPolicy = "smudge"
+	// LFSSkip checks out pointers, then downloads only the files matching
+	// the configured include patterns
+	LFSSkip LFSPolicy = "skip"
+	// LFSShare checks out pointers, then fills in every file whose content
+	// the main checkout's LFS store already has, without downloading
+	LFSShare LFSPolicy = "share"
+)
+
+// ParseLFSPolicy validates an LFS policy given on the command line or in
+// config
+func ParseLFSPolicy(s string) (LFSPolicy, error) {
+	switch policy := LFSPolicy(s); policy {
+	case LFSSmudge, LFSSkip, LFSShare:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid LFS policy %q: want smudge, skip or share", s)
+	}
+}
+
+// skipsSmudge reports whether the checkout of a session created with opts
+// from commit should leave LFS files as pointers
+func (m *Manager) skipsSmudge(ctx context.Context, opts CreateOptions, commit string) bool {
+	if opts.LFS == "" || opts.LFS == LFSSmudge {
+		return false
+	}
+	uses, err := m.Git.UsesLFS(ctx, commit)
+	if err != nil {
+		m.printf("Warning: %v\n", err)
+	}
+	return uses
+}
+
+// fillLFS replaces the LFS pointers of a new session's worktree as opts.LFS
+// says. Failures are only warnings: the session is usable, and the files can
+// be fetched later with git lfs pull.
+func (m *Manager) fillLFS(ctx context.Context, opts CreateOptions, worktreePath string) error {
+	var err error
+	switch opts.LFS {
+	case LFSSkip:
+		if len(opts.LFSInclude) == 0 {
+			m.printf("Leaving Git LFS files as pointers\n")
+			return nil
+		}
+		m.printf("Pulling Git LFS files in %s...\n", strings.Join(opts.LFSInclude, ", "))
+		err = m.Git.LFSPull(ctx, worktreePath, opts.LFSInclude)
+	case LFSShare:
+		var commonDir string
+		if commonDir, err = m.Git.GetCommonDir(ctx); err == nil {
+			storage := filepath.Join(commonDir, "lfs")
+			m.printf("Filling in Git LFS files from %s...\n", storage)
+			err = m.Git.LFSCheckout(ctx, worktreePath, storage)
+		}
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		m.printf("Warning: %v\n", err)
+		m.printf("Run `git lfs pull` in the session to fetch them\n")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockFile      = "wt.lock"
+	fetchLockFile = "wt-fetch.lock"
+	// lockPollInterval is how often a waiting wt retries the lock
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// lockRepo takes the repository's wt lock, an advisory file lock in its git
+// directory. Operations that create or remove sessions hold it so that
+// concurrent wt processes don't race on names, branches, worktrees and git's
+// own lock files. It waits up to m.LockTimeout (forever if zero) for other
+// holders, and returns ErrLocked when that runs out.
+func (m *Manager) lockRepo(ctx context.Context) (unlock func(), err error) {
+	dir, err := m.Git.GetCommonDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.lockPath(ctx, filepath.Join(dir, lockFile))
+}
+
+// lockFetch takes the repository's fetch lock, which wt holds while it
+// fetches and updates the source branch of new sessions, apart from the
+// repository lock. It waits as lockRepo does.
+func (m *Manager) lockFetch(ctx context.Context) (unlock func(), err error) {
+	dir, err := m.Git.GetCommonDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.lockPath(ctx, filepath.Join(dir, fetchLockFile))
+}
+
+// lockPath takes an advisory lock on the file at path, creating it if
+// needed, and waits for it as lockRepo does
+func (m *Manager) lockPath(ctx context.Context, path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	var deadline <-chan time.Time
+	if m.LockTimeout > 0 {
+		timer := time.NewTimer(m.LockTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	waiting := false
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+
+		if !waiting {
+			waiting = true
+			m.printf("Waiting for another wt process%s to finish...\n", lockHolder(f))
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-deadline:
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: gave up after %s (lock file %s)", ErrLocked, m.LockTimeout, path)
+		case <-ticker.C:
+		}
+	}
+
+	// Record who holds the lock for anyone waiting on it
+	_ = f.Truncate(0)
+	_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return func() {
+		_ = f.Truncate(0)
+		_ = unlockFile(f)
+		_ = f.Close()
+	}, nil
+}
+
+// lockHolder describes the process recorded in the lock file, if any
+func lockHolder(f *os.File) string {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	if pid := strings.TrimSpace(string(buf[:n])); pid != "" {
+		return " (pid " + pid + ")"
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package session
+
+import "os"
+
+// tryLockFile always succeeds where advisory locks aren't supported
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockRepoTimeout(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.LockTimeout = 50 * time.Millisecond
+
+	unlock, err := m.lockRepo(t.Context())
+	if err != nil {
+		t.Fatalf("lockRepo() error: %v", err)
+	}
+
+	if _, err := m.lockRepo(t.Context()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second lockRepo() error = %v, want ErrLocked", err)
+	}
+
+	unlock()
+	unlock, err = m.lockRepo(t.Context())
+	if err != nil {
+		t.Fatalf("lockRepo() after unlock error: %v", err)
+	}
+	unlock()
+}
+
+func TestLockRepoWaits(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	unlock, err := m.lockRepo(t.Context())
+	if err != nil {
+		t.Fatalf("lockRepo() error: %v", err)
+	}
+	time.AfterFunc(150*time.Millisecond, unlock)
+
+	start := time.Now()
+	unlock2, err := m.lockRepo(t.Context())
+	if err != nil {
+		t.Fatalf("waiting lockRepo() error: %v", err)
+	}
+	unlock2()
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("lockRepo() should have waited for the holder")
+	}
+}
+
+func TestRemoveAllDoesNotDeadlock(t *testing.T) {
+	m, runner := newTestManager(t)
+	m.LockTimeout = time.Second
+	stubWorktrees(m, runner, "alpha", "beta")
+
+	if err := m.RemoveAll(t.Context(), true); err != nil {
+		t.Fatalf("RemoveAll() error: %v", err)
+	}
+}
+
+func TestBeginFetchesOutsideRepoLock(t *testing.T) {
+	m, runner := newTestManager(t)
+	m.LockTimeout = time.Second
+	runner.Hang("fetch")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Begin(ctx, createOpts("feature"))
+		done <- err
+	}()
+	for !runner.Called("fetch") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Another wt can create or remove sessions while the remote is slow
+	unlock, err := m.lockRepo(t.Context())
+	if err != nil {
+		t.Errorf("lockRepo() during a fetch error: %v", err)
+	} else {
+		unlock()
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Begin() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,753 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/git/gittest"
+)
+
+// newTestManager returns a Manager for a repository named "myrepo" whose
+// worktrees live in a temporary base directory
+func newTestManager(t *testing.T) (*Manager, *gittest.Runner) {
+	t.Helper()
+	runner := &gittest.Runner{}
+	runner.On("rev-parse --show-toplevel", "/src/myrepo\n", nil)
+	runner.On("remote", "origin\n", nil)
+	runner.On("rev-parse --path-format=absolute --git-common-dir", t.TempDir()+"\n", nil)
+	m := &Manager{
+		Git:     git.New(runner, io.Discard, io.Discard),
+		BaseDir: t.TempDir(),
+		Out:     io.Discard,
+	}
+	return m, runner
+}
+
+// createOpts returns options for creating name from main with fetching on
+func createOpts(name string) CreateOptions {
+	return CreateOptions{Name: name, SourceBranch: "main", Fetch: true}
+}
+
+// stubWorktrees makes `git worktree list` report the main checkout plus one
+// worktree per session name
+func stubWorktrees(m *Manager, runner *gittest.Runner, names ...string) {
+	var b strings.Builder
+	b.WriteString("worktree /src/myrepo\nHEAD abc\nbranch refs/heads/main\n\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "worktree %s\nHEAD def\nbranch refs/heads/wt-%s\n\n", m.WorktreePath("myrepo", name), name)
+	}
+	runner.On("worktree list --porcelain", b.String(), nil)
+}
+
+func TestManagerList(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "alpha", "beta")
+
+	sessions, err := m.List(t.Context())
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("List() returned %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].Name != "alpha" || sessions[0].Branch != "wt-alpha" {
+		t.Errorf("sessions[0] = %+v, want alpha on wt-alpha", sessions[0])
+	}
+}
+
+func TestManagerFind(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "auth-feature", "auth-fix", "billing")
+
+	tests := []struct {
+		query   string
+		want    string
+		wantErr error
+	}{
+		{"billing", "billing", nil},
+		{"bill", "billing", nil},
+		{"auth-fix", "auth-fix", nil},
+		{"auth", "", ErrAmbiguous},
+		{"nope", "", ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		s, err := m.Find(t.Context(), tt.query)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Find(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Find(%q) error: %v", tt.query, err)
+			continue
+		}
+		if s.Name != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.query, s.Name, tt.want)
+		}
+	}
+}
+
+func TestManagerFindAmbiguousListsMatches(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "auth-feature", "auth-fix")
+	used := time.Date(2026, 3, 4, 10, 30, 0, 0, time.Local)
+	if err := m.SaveMetadata(m.WorktreePath("myrepo", "auth-fix"), Metadata{ResumedAt: used}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := m.Find(t.Context(), "auth")
+	var ambiguous *AmbiguousError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("Find() error = %v, want *AmbiguousError", err)
+	}
+	if len(ambiguous.Matches) != 2 || ambiguous.Matches[0].Name != "auth-fix" {
+		t.Errorf("Matches = %+v, want both auth sessions, most recently used first", ambiguous.Matches)
+	}
+	for _, want := range []string{"wt-auth-feature", "wt-auth-fix", "last used Mar 4 10:30"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestManagerFindRanking(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "auth-feature", "billing-api", "docs")
+	if err := m.SaveMetadata(m.WorktreePath("myrepo", "docs"), Metadata{Tags: []string{"Frontend"}, Prompt: "Document the checkout flow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		want    string
+		wantErr error
+	}{
+		// A substring of the name beats a subsequence of another's
+		{"api", "billing-api", nil},
+		{"FEAT", "auth-feature", nil},
+		{"wt-docs", "docs", nil},
+		{"front", "docs", nil},
+		{"blapi", "billing-api", nil},
+		{"checkout", "docs", nil},
+		// Every branch starts with wt-
+		{"wt-", "", ErrAmbiguous},
+		{"zzz", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		s, err := m.Find(t.Context(), tt.query)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Find(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Find(%q) error: %v", tt.query, err)
+			continue
+		}
+		if s.Name != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.query, s.Name, tt.want)
+		}
+	}
+}
+
+func TestManagerFindStrict(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "auth-feature", "docs")
+	if err := m.SaveMetadata(m.WorktreePath("myrepo", "docs"), Metadata{Prompt: "Document the auth flow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"auth-feature", "wt-docs", "auth", "DOC"} {
+		if _, err := m.FindStrict(t.Context(), query); err != nil {
+			t.Errorf("FindStrict(%q) error: %v", query, err)
+		}
+	}
+	// A substring, the name's letters or the prompt aren't enough
+	for _, query := range []string{"feature", "af", "flow"} {
+		var loose *LooseMatchError
+		s, err := m.FindStrict(t.Context(), query)
+		if !errors.As(err, &loose) || !errors.Is(err, ErrNotFound) || s == nil {
+			t.Errorf("FindStrict(%q) = %v, %v, want a LooseMatchError", query, s, err)
+		}
+	}
+}
+
+func TestManagerRemoveLooseMatch(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "feature")
+
+	if err := m.Remove(t.Context(), "eat", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Remove() error = %v, want ErrNotFound", err)
+	}
+	if runner.Called("worktree remove") {
+		t.Error("a loosely matched session should not be removed")
+	}
+}
+
+func TestManagerCreate(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+
+	s, err := m.Create(t.Context(), createOpts("feature"))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	wantPath := filepath.Join(m.BaseDir, "myrepo-feature")
+	if s.Path != wantPath || s.Branch != "wt-feature" {
+		t.Errorf("Create() = %+v, want branch wt-feature at %s", s, wantPath)
+	}
+	for _, call := range []string{"fetch origin +refs/heads/main:refs/remotes/origin/main", "branch --no-track wt-feature refs/remotes/origin/main", "worktree add " + wantPath + " wt-feature"} {
+		if !runner.Called(call) {
+			t.Errorf("expected git %s, calls: %v", call, runner.Calls())
+		}
+	}
+}
+
+func TestManagerCreateAlreadyExists(t *testing.T) {
+	m, runner := newTestManager(t)
+	if err := os.MkdirAll(m.WorktreePath("myrepo", "feature"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := m.Create(t.Context(), createOpts("feature"))
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("Create() error = %v, want ErrAlreadyExists", err)
+	}
+	if runner.Called("fetch") {
+		t.Error("nothing should be fetched for an existing session")
+	}
+}
+
+func TestManagerCreateNotARepo(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --show-toplevel", "", gittest.Fail("fatal: not a git repository"))
+
+	if _, err := m.Create(t.Context(), createOpts("feature")); !errors.Is(err, git.ErrNotARepo) {
+		t.Fatalf("Create() error = %v, want git.ErrNotARepo", err)
+	}
+}
+
+func TestManagerCreateExistingBranch(t *testing.T) {
+	m, runner := newTestManager(t)
+
+	if _, err := m.Create(t.Context(), createOpts("feature")); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if runner.Called("branch wt-feature") {
+		t.Errorf("existing branch should be reused, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerCreateFetchFailureIsNonFatal(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("fetch origin", "", gittest.Fail("fatal: 'origin' does not appear to be a git repository"))
+
+	if _, err := m.Create(t.Context(), createOpts("feature")); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+}
+
+func TestManagerCreateRemoteBaseLeavesLocalBranch(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+	runner.On("rev-parse --verify --quiet refs/remotes/origin/main^{commit}", "1234567890abcdef\n", nil)
+
+	s, err := m.Create(t.Context(), createOpts("feature"))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	for _, call := range []string{"merge", "pull", "fetch ."} {
+		if runner.Called(call) {
+			t.Errorf("remote base should not touch the local branch, got git %s", call)
+		}
+	}
+
+	want := Metadata{SourceBranch: "main", BaseRef: "origin/main", BaseMode: BaseRemote, BaseCommit: "1234567890abcdef"}
+	got := s.Meta
+	got.CreatedAt = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Meta = %+v, want %+v", got, want)
+	}
+
+	saved, err := m.LoadMetadata(s.Path)
+	if err != nil {
+		t.Fatalf("LoadMetadata() error: %v", err)
+	}
+	if saved.BaseRef != "origin/main" || saved.CreatedAt.IsZero() {
+		t.Errorf("saved metadata = %+v", saved)
+	}
+}
+
+func TestManagerCreateLocalBase(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+	runner.On("rev-parse --abbrev-ref HEAD", "main\n", nil)
+	opts := createOpts("feature")
+	opts.Base = BaseLocal
+
+	s, err := m.Create(t.Context(), opts)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	for _, call := range []string{"merge --ff-only refs/remotes/origin/main", "branch --no-track wt-feature main"} {
+		if !runner.Called(call) {
+			t.Errorf("expected git %s, calls: %v", call, runner.Calls())
+		}
+	}
+	if s.Meta.BaseRef != "main" || s.Meta.BaseMode != BaseLocal {
+		t.Errorf("Meta = %+v, want local base main", s.Meta)
+	}
+}
+
+func TestManagerCreateOffline(t *testing.T) {
+	m, runner := newTestManager(t)
+	opts := createOpts("feature")
+	opts.Fetch = false
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+
+	if _, err := m.Create(t.Context(), opts); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if runner.Called("fetch origin") {
+		t.Errorf("offline create should not fetch, calls: %v", runner.Calls())
+	}
+	if !runner.Called("branch --no-track wt-feature refs/remotes/origin/main") {
+		t.Errorf("offline create should branch from the last fetched ref, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerCreateNoRemote(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("remote", "", nil)
+
+	if _, err := m.Create(t.Context(), createOpts("feature")); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if runner.Called("fetch") || runner.Called("merge") {
+		t.Errorf("nothing to update without a remote, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerCreateRecentlyFetched(t *testing.T) {
+	m, runner := newTestManager(t)
+	fetchHead := filepath.Join(t.TempDir(), "FETCH_HEAD")
+	if err := os.WriteFile(fetchHead, []byte("1234\t\tbranch 'main' of /srv/origin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runner.On("rev-parse --git-path FETCH_HEAD", fetchHead, nil)
+
+	opts := createOpts("fresh")
+	opts.FetchInterval = time.Hour
+	if _, err := m.Create(t.Context(), opts); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if runner.Called("fetch origin") {
+		t.Errorf("recently fetched branch should not be fetched again, calls: %v", runner.Calls())
+	}
+
+	// Backdate the fetch beyond the interval
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(fetchHead, old, old); err != nil {
+		t.Fatal(err)
+	}
+	opts.Name = "stale"
+	if _, err := m.Create(t.Context(), opts); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if !runner.Called("fetch origin") {
+		t.Errorf("stale branch should be fetched, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerCreateNoCommits(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse main", "", errors.New("unknown revision"))
+	runner.On("rev-parse refs/remotes/origin/main", "", errors.New("unknown revision"))
+
+	_, err := m.Create(t.Context(), createOpts("feature"))
+	if err == nil || !strings.Contains(err.Error(), "has no commits") {
+		t.Fatalf("Create() error = %v, want no commits error", err)
+	}
+	if runner.Called("worktree add") {
+		t.Error("worktree should not be added without commits")
+	}
+}
+
+func TestManagerCreateWorktreeFailure(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-feature", "", errors.New("unknown revision"))
+	runner.On("worktree add", "", gittest.Fail("fatal: disk full"))
+
+	_, err := m.Create(t.Context(), createOpts("feature"))
+	var cmdErr *git.CommandError
+	if !errors.As(err, &cmdErr) || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Create() error = %v, want *git.CommandError with git's message", err)
+	}
+	if !runner.Called("branch -D wt-feature") {
+		t.Errorf("new branch should be cleaned up, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerRemove(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "feature")
+
+	if err := m.Remove(t.Context(), "feat", false); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	if !runner.Called("worktree remove --force " + m.WorktreePath("myrepo", "feature")) {
+		t.Errorf("expected worktree removal, calls: %v", runner.Calls())
+	}
+	if !runner.Called("branch -D wt-feature") {
+		t.Errorf("expected branch deletion, calls: %v", runner.Calls())
+	}
+}
+
+func TestManagerRemoveNotFound(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner)
+
+	if err := m.Remove(t.Context(), "missing", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Remove() error = %v, want ErrNotFound", err)
+	}
+	if runner.Called("worktree remove") {
+		t.Error("nothing should be removed")
+	}
+}
+
+func TestManagerRemoveDirty(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "feature")
+	runner.On("-C "+m.WorktreePath("myrepo", "feature")+" status --porcelain", "?? notes.txt\n", nil)
+
+	// Uncommitted changes go with the worktree, as they always have
+	if err := m.Remove(t.Context(), "feature", false); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	if !runner.Called("worktree remove --force") {
+		t.Error("dirty session should be removed")
+	}
+}
+
+func TestManagerRemoveAllSkipped(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "busy", "idle")
+	lock, err := m.LockAgent(m.WorktreePath("myrepo", "busy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lock.Close() }()
+
+	err = m.RemoveAll(t.Context(), false)
+	var skipped *SkippedError
+	if !errors.As(err, &skipped) || !errors.Is(err, ErrAgentRunning) {
+		t.Fatalf("RemoveAll() error = %v, want a SkippedError for the running agent", err)
+	}
+	if !slices.Equal(skipped.Names, []string{"busy"}) || skipped.Total != 2 {
+		t.Errorf("skipped %v of %d, want [busy] of 2", skipped.Names, skipped.Total)
+	}
+}
+
+func TestManagerBeginBatch(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-try-1", "", errors.New("unknown revision"))
+	runner.On("rev-parse --verify wt-try-2", "", errors.New("unknown revision"))
+	runner.On("rev-parse --verify --quiet refs/remotes/origin/main^{commit}", "1234567890abcdef\n", nil)
+
+	creations, err := m.BeginBatch(t.Context(), createOpts("try"), 2)
+	if err != nil {
+		t.Fatalf("BeginBatch() error: %v", err)
+	}
+	if len(creations) != 2 {
+		t.Fatalf("BeginBatch() returned %d creations, want 2", len(creations))
+	}
+
+	fetches := 0
+	for _, call := range runner.Calls() {
+		if strings.HasPrefix(call, "fetch ") {
+			fetches++
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched %d times, want once: %v", fetches, runner.Calls())
+	}
+	for _, name := range []string{"try-1", "try-2"} {
+		if !runner.Called("branch --no-track wt-" + name + " 1234567890abcdef") {
+			t.Errorf("%s should start from the pinned commit, calls: %v", name, runner.Calls())
+		}
+	}
+}
+
+func TestManagerBeginGeneratesName(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner)
+	for _, branch := range []string{"wt-session-1", "wt-session-1-1", "wt-session-1-2"} {
+		runner.On("rev-parse --verify "+branch, "", errors.New("unknown revision"))
+	}
+
+	opts := createOpts("")
+	opts.Names = NameOptions{Generator: NamesCounter}
+	creations, err := m.BeginBatch(t.Context(), opts, 2)
+	if err != nil {
+		t.Fatalf("BeginBatch() error: %v", err)
+	}
+	for i, want := range []string{"session-1-1", "session-1-2"} {
+		if got := creations[i].Session.Name; got != want {
+			t.Errorf("session %d named %q, want %q", i, got, want)
+		}
+	}
+	if n, err := m.lastCount(t.Context()); err != nil || n != 1 {
+		t.Errorf("counter = %d, %v; want 1 taken", n, err)
+	}
+}
+
+func TestManagerBeginBatchRollsBackAll(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-try-1", "", errors.New("unknown revision"))
+	runner.On("rev-parse --verify wt-try-2", "", errors.New("unknown revision"))
+	runner.On("worktree add "+m.WorktreePath("myrepo", "try-2"), "", gittest.Fail("fatal: disk full"))
+
+	if _, err := m.BeginBatch(t.Context(), createOpts("try"), 2); err == nil {
+		t.Fatal("BeginBatch() should fail when one session can't be created")
+	}
+	for _, branch := range []string{"wt-try-1", "wt-try-2"} {
+		if !runner.Called("branch -D " + branch) {
+			t.Errorf("branch %s should be rolled back, calls: %v", branch, runner.Calls())
+		}
+	}
+	if _, err := os.Stat(m.StateDir(m.WorktreePath("myrepo", "try-1"))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state of try-1 should be removed: %v", err)
+	}
+}
+
+func TestManagerFindSelectors(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "alpha", "beta", "gamma")
+	for _, name := range []string{"gamma", "alpha", "beta", "alpha"} {
+		if err := m.RecordUse(t.Context(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inGamma := filepath.Join(m.WorktreePath("myrepo", "gamma"), "src")
+	if err := os.MkdirAll(inGamma, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(inGamma)
+
+	tests := []struct {
+		query   string
+		want    string
+		wantErr error
+	}{
+		{"1", "alpha", nil},
+		{"3", "gamma", nil},
+		{"4", "", ErrNotFound},
+		{"0", "", ErrNotFound},
+		{"-", "alpha", nil},
+		{"@prev", "beta", nil},
+		{"@", "gamma", nil},
+	}
+	for _, tt := range tests {
+		s, err := m.Find(t.Context(), tt.query)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Find(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Find(%q) error: %v", tt.query, err)
+			continue
+		}
+		if s.Name != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.query, s.Name, tt.want)
+		}
+	}
+
+	t.Chdir(t.TempDir())
+	if _, err := m.Find(t.Context(), "@"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find(@) outside any session error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerFindLastWithoutHistory(t *testing.T) {
+	m, runner := newTestManager(t)
+	stubWorktrees(m, runner, "alpha")
+
+	if _, err := m.Find(t.Context(), "-"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find(-) error = %v, want ErrNotFound", err)
+	}
+	if err := m.RecordUse(t.Context(), "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Find(t.Context(), "@prev"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find(@prev) with one session used error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerRecordUseKeepsHistoryShort(t *testing.T) {
+	m, _ := newTestManager(t)
+	for i := range historyLimit + 5 {
+		if err := m.RecordUse(t.Context(), fmt.Sprintf("s%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RecordUse(t.Context(), "s10"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := m.History(t.Context())
+	if err != nil {
+		t.Fatalf("History() error: %v", err)
+	}
+	if len(names) != historyLimit || names[0] != "s10" || slices.Index(names[1:], "s10") >= 0 {
+		t.Errorf("History() = %v, want %d names with s10 first and only once", names, historyLimit)
+	}
+}
+
+func TestManagerCreateHierarchicalName(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-auth/login", "", errors.New("unknown revision"))
+
+	s, err := m.Create(t.Context(), createOpts("auth/login"))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if s.Branch != "wt-auth/login" || filepath.Base(s.Path) != "myrepo-auth~login" {
+		t.Errorf("session = %+v, want branch wt-auth/login in myrepo-auth~login", s)
+	}
+
+	stubWorktrees(m, runner, "auth/login")
+	sessions, err := m.List(t.Context())
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != "auth/login" {
+		t.Errorf("List() = %+v, want auth/login", sessions)
+	}
+}
+
+func TestManagerCreateRejectsInvalidName(t *testing.T) {
+	m, runner := newTestManager(t)
+
+	if _, err := m.Create(t.Context(), createOpts("../../tmp/x")); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Create() error = %v, want ErrInvalidName", err)
+	}
+	for _, call := range []string{"branch", "worktree add", "fetch"} {
+		if runner.Called(call) {
+			t.Errorf("invalid name should be rejected before git %s", call)
+		}
+	}
+}
+
+func TestManagerCreateSparse(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-api", "", errors.New("unknown revision"))
+
+	opts := createOpts("api")
+	opts.Sparse = []string{"services/api/", "libs"}
+	s, err := m.Create(t.Context(), opts)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	want := []string{
+		"worktree add --no-checkout " + s.Path + " wt-api",
+		"-C " + s.Path + " sparse-checkout set --cone -- services/api libs",
+		"-C " + s.Path + " checkout",
+	}
+	var got []string
+	for _, call := range runner.Calls() {
+		if strings.Contains(call, "worktree add") || strings.HasPrefix(call, "-C "+s.Path) {
+			got = append(got, call)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("worktree calls = %q, want %q", got, want)
+	}
+
+	meta, err := m.LoadMetadata(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(meta.Sparse, []string{"services/api", "libs"}) {
+		t.Errorf("Sparse = %q, want the cleaned paths recorded", meta.Sparse)
+	}
+}
+
+func TestManagerSparseAddFullCheckout(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("-C /wt/full sparse-checkout list", "", &git.CommandError{Stderr: "fatal: this worktree is not sparse", Err: errors.New("exit status 128")})
+
+	err := m.SparseAdd(t.Context(), &Session{Name: "full", Path: "/wt/full"}, []string{"docs"})
+	if !errors.Is(err, ErrNotSparse) {
+		t.Fatalf("SparseAdd() error = %v, want ErrNotSparse", err)
+	}
+	if runner.Called("-C /wt/full sparse-checkout add") {
+		t.Error("a full checkout should be left alone")
+	}
+}
+
+func TestManagerCreateLFS(t *testing.T) {
+	tests := []struct {
+		policy LFSPolicy
+		want   string
+	}{
+		{LFSSkip, "lfs pull --include=assets/**,docs/*.png"},
+		{LFSShare, "lfs checkout"},
+	}
+	for _, tt := range tests {
+		m, runner := newTestManager(t)
+		runner.On("rev-parse --verify wt-art", "", errors.New("unknown revision"))
+		runner.On("grep -q -e filter=lfs", "", nil)
+
+		opts := createOpts("art")
+		opts.LFS = tt.policy
+		opts.LFSInclude = []string{"assets/**", "docs/*.png"}
+		s, err := m.Create(t.Context(), opts)
+		if err != nil {
+			t.Fatalf("Create(%s) error: %v", tt.policy, err)
+		}
+
+		skip := "-c filter.lfs.smudge=git-lfs smudge --skip -- %f -c filter.lfs.process=git-lfs filter-process --skip worktree add " + s.Path
+		if !runner.Called(skip) {
+			t.Errorf("%s: checkout should skip the LFS smudge filter, calls: %v", tt.policy, runner.Calls())
+		}
+		called := false
+		for _, call := range runner.Calls() {
+			called = called || strings.HasPrefix(call, "-C "+s.Path) && strings.HasSuffix(call, tt.want)
+		}
+		if !called {
+			t.Errorf("%s: expected git ... %s, calls: %v", tt.policy, tt.want, runner.Calls())
+		}
+	}
+}
+
+func TestManagerCreateLFSNotUsed(t *testing.T) {
+	m, runner := newTestManager(t)
+	runner.On("rev-parse --verify wt-art", "", errors.New("unknown revision"))
+	runner.On("grep -q -e filter=lfs", "", gittest.Fail(""))
+
+	opts := createOpts("art")
+	opts.LFS = LFSSkip
+	s, err := m.Create(t.Context(), opts)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if !runner.Called("worktree add "+s.Path) || runner.Called("-C "+s.Path+" lfs") {
+		t.Errorf("a repository without LFS should be checked out as usual, calls: %v", runner.Calls())
+	}
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"strings"
+)
+
+// matchRank is how well a query matches a session; higher is better
+type matchRank int
+
+const (
+	noMatch matchRank = iota
+	// descriptionMatch: the query occurs in the session's prompt
+	descriptionMatch
+	// subsequenceMatch: the name contains the query's characters in order
+	subsequenceMatch
+	// tagMatch: the query occurs in one of the session's tags
+	tagMatch
+	// branchMatch: the query occurs in the session's branch name
+	branchMatch
+	// substringMatch: the query occurs in the name
+	substringMatch
+	// prefixMatch: the name starts with the query
+	prefixMatch
+	// exactMatch: the query is the name, the branch or a selector
+	exactMatch
+)
+
+// rank scores how well query, which must be lowercase, matches s, ignoring
+// case
+func rank(query string, s Session) matchRank {
+	name := strings.ToLower(s.Name)
+	switch {
+	case strings.HasPrefix(name, query):
+		return prefixMatch
+	case strings.Contains(name, query):
+		return substringMatch
+	case strings.Contains(strings.ToLower(s.Branch), query):
+		return branchMatch
+	}
+	for _, tag := range s.Meta.Tags {
+		if strings.Contains(strings.ToLower(tag), query) {
+			return tagMatch
+		}
+	}
+	switch {
+	case FuzzyMatch(query, name):
+		return subsequenceMatch
+	case strings.Contains(strings.ToLower(s.Meta.Prompt), query):
+		return descriptionMatch
+	}
+	return noMatch
+}
+
+// FuzzyMatch reports whether the characters of query appear in s in order,
+// ignoring case
+func FuzzyMatch(query, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// StateDirName is the directory under the base directory holding wt's
+	// own per-session files, kept out of the worktrees themselves
+	StateDirName = ".state"
+	metadataFile = "session.json"
+)
+
+// Metadata is what wt records about a session beyond what git knows.
+// Sessions created by older versions of wt have none.
+type Metadata struct {
+	SourceBranch string `json:"source_branch,omitempty"`
+	// BaseRef is what the session branch was created from, e.g. origin/main
+	// for a remote base or main for a local one; empty if an existing branch
+	// was reused
+	BaseRef    string    `json:"base_ref,omitempty"`
+	BaseMode   BaseMode  `json:"base_mode,omitempty"`
+	BaseCommit string    `json:"base_commit,omitempty"`
+	CreatedAt  time.Time `json:"created_at,omitzero"`
+	// Prompt is the initial instruction the agent was started with
+	Prompt string `json:"prompt,omitempty"`
+	// ResumedAt is when the session was last resumed with wt fg
+	ResumedAt time.Time `json:"resumed_at,omitzero"`
+	// Tags are labels given when the session was created, to find it by
+	Tags []string `json:"tags,omitempty"`
+	// Sparse lists the directories checked out in a sparse session; empty
+	// means everything is
+	Sparse []string `json:"sparse,omitempty"`
+}
+
+// StateDir returns the directory holding wt's files for the session whose
+// worktree is at worktreePath
+func (m *Manager) StateDir(worktreePath string) string {
+	return filepath.Join(m.BaseDir, StateDirName, filepath.Base(worktreePath))
+}
+
+// LoadMetadata reads the metadata of the session at worktreePath. Missing
+// metadata is not an error.
+func (m *Manager) LoadMetadata(worktreePath string) (Metadata, error) {
+	var meta Metadata
+	data, err := os.ReadFile(filepath.Join(m.StateDir(worktreePath), metadataFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read session metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse session metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// SaveMetadata writes the metadata of the session at worktreePath
+func (m *Manager) SaveMetadata(worktreePath string, meta Metadata) error {
+	dir := m.StateDir(worktreePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, metadataFile), append(data, '\n'))
+}
+
+// writeFileAtomic replaces path with data so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,107 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxNameLength keeps worktree directory names well within filesystem limits
+const maxNameLength = 100
+
+// dirSeparator stands in for "/" in the directory names of hierarchical
+// sessions such as auth/login. It can't appear in a valid name, so the
+// mapping is reversible.
+const dirSeparator = "~"
+
+// ValidateName checks that name can be used for a session: its branch
+// wt-<name> must pass `git check-ref-format`, its worktree must stay inside
+// the base directory, and it must not read as a selector or a flag. Names
+// may be hierarchical, like auth/login.
+func ValidateName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w '%s': %s", ErrInvalidName, name, reason)
+	}
+
+	switch {
+	case name == "":
+		return invalid("it is empty")
+	case len(name) > maxNameLength:
+		return invalid(fmt.Sprintf("it is longer than %d characters", maxNameLength))
+	case strings.HasPrefix(name, "-"):
+		return invalid("it can't start with '-'")
+	case strings.HasPrefix(name, "@"):
+		return invalid("it can't start with '@'")
+	case strings.Trim(name, "0123456789") == "":
+		return invalid("a number would select a session by its position in wt ls")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return invalid("it can't start or end with '/'")
+	case strings.HasSuffix(name, "."):
+		return invalid("it can't end with '.'")
+	case strings.Contains(name, ".."):
+		return invalid("it can't contain '..'")
+	case strings.Contains(name, "@{"):
+		return invalid("it can't contain '@{'")
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return invalid("it can't contain spaces or control characters")
+		}
+		if strings.ContainsRune(`~^:?*[\`, r) {
+			return invalid(fmt.Sprintf("it can't contain '%c'", r))
+		}
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		switch {
+		case part == "":
+			return invalid("it can't contain '//'")
+		case strings.HasPrefix(part, "."):
+			return invalid("no part of it can start with '.'")
+		case strings.HasSuffix(part, ".lock"):
+			return invalid("no part of it can end with '.lock'")
+		}
+	}
+	return nil
+}
+
+// Slugify turns free text, such as a task title, into a valid session
+// name: lowercase words joined by '-', keeping '/' between parts. The result
+// is empty if nothing usable is left.
+func Slugify(s string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.ToLower(s), "/") {
+		var b strings.Builder
+		dash := false
+		for _, r := range part {
+			switch {
+			case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '_':
+				b.WriteRune(r)
+				dash = false
+			case !dash && b.Len() > 0:
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+		if part := strings.TrimSuffix(b.String(), "-"); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	name := strings.Join(parts, "/")
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength], "-/")
+	}
+	return name
+}
+
+// dirName returns the worktree directory name, without the repository
+// prefix, of the session called name
+func dirName(name string) string {
+	return strings.ReplaceAll(name, "/", dirSeparator)
+}
+
+// nameFromDir reverses dirName
+func nameFromDir(dir string) string {
+	return strings.ReplaceAll(dir, dirSeparator, "/")
+}
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	portsFile     = "ports.json"
+	portsLockFile = "ports.lock"
+)
+
+// PortRange is where sessions' port blocks are allocated from
+type PortRange struct {
+	First, Last int
+	// Block is how many ports each session gets
+	Block int
+}
+
+// ParsePortRange parses a range given in config as first-last, e.g.
+// 4000-4999, to be split into blocks of block ports. An empty s gives the
+// zero PortRange, which allocates nothing.
+func ParsePortRange(s string, block int) (PortRange, error) {
+	if s == "" {
+		return PortRange{}, nil
+	}
+	first, last, ok := strings.Cut(s, "-")
+	r := PortRange{Block: block}
+	var err1, err2 error
+	r.First, err1 = strconv.Atoi(strings.TrimSpace(first))
+	r.Last, err2 = strconv.Atoi(strings.TrimSpace(last))
+	if !ok || err1 != nil || err2 != nil || r.First < 1 || r.Last > 65535 || r.First > r.Last {
+		return PortRange{}, fmt.Errorf("invalid port range %q: want first-last, e.g. 4000-4999", s)
+	}
+	if block < 1 || block > r.Last-r.First+1 {
+		return PortRange{}, fmt.Errorf("invalid port block size %d: want between 1 and the size of the range %s", block, s)
+	}
+	return r, nil
+}
+
+// PortBlock is the consecutive ports reserved for one session
+type PortBlock struct {
+	First int `json:"first"`
+	Count int `json:"count"`
+}
+
+// Last returns the block's last port
+func (b PortBlock) Last() int {
+	return b.First + b.Count - 1
+}
+
+// String describes the block as first-last
+func (b PortBlock) String() string {
+	if b.Count == 1 {
+		return strconv.Itoa(b.First)
+	}
+	return fmt.Sprintf("%d-%d", b.First, b.Last())
+}
+
+// Env returns the environment variables that tell programs in a session
+// which ports are theirs: PORT and WT_PORT hold the first, WT_PORT_LAST the
+// last. The zero block has none.
+func (b PortBlock) Env() []string {
+	if b.Count == 0 {
+		return nil
+	}
+	return []string{
+		"WT_PORT=" + strconv.Itoa(b.First),
+		"WT_PORT_LAST=" + strconv.Itoa(b.Last()),
+		"PORT=" + strconv.Itoa(b.First),
+	}
+}
+
+// overlaps reports whether b and o share a port
+func (b PortBlock) overlaps(o PortBlock) bool {
+	return b.First <= o.Last() && o.First <= b.Last()
+}
+
+// portsPath returns the file recording which worktree holds which ports.
+// It's shared by all repositories, since their sessions share the machine's
+// ports.
+func (m *Manager) portsPath() string {
+	return filepath.Join(m.BaseDir, StateDirName, portsFile)
+}
+
+// Ports returns the block of ports reserved for s, allocating one from
+// m.PortRange the first time. A session keeps its block, across restarts of
+// wt and of its agent, until it is removed. The block is chosen so it
+// overlaps no other session's and none of its ports is in use. Without a
+// configured range, it returns the zero PortBlock.
+func (m *Manager) Ports(ctx context.Context, s *Session) (PortBlock, error) {
+	if m.PortRange.Block == 0 {
+		return PortBlock{}, nil
+	}
+	var block PortBlock
+	err := m.updatePorts(ctx, func(blocks map[string]PortBlock) error {
+		if b, ok := blocks[s.Path]; ok {
+			block = b
+			return nil
+		}
+		// Blocks of removed worktrees are free again, even when wt rm
+		// didn't get to release them
+		for path := range blocks {
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				delete(blocks, path)
+			}
+		}
+
+		r := m.PortRange
+		for first := r.First; first+r.Block-1 <= r.Last; first += r.Block {
+			candidate := PortBlock{First: first, Count: r.Block}
+			if !reserved(blocks, candidate) && portsFree(candidate) {
+				block = candidate
+				blocks[s.Path] = block
+				return nil
+			}
+		}
+		return fmt.Errorf("no free block of %d ports left in %d-%d for session '%s'", r.Block, r.First, r.Last, s.Name)
+	})
+	return block, err
+}
+
+// AssignedPorts returns the block reserved for the worktree at path, if
+// any, without allocating one
+func (m *Manager) AssignedPorts(path string) (PortBlock, bool) {
+	blocks, err := m.readPorts()
+	if err != nil {
+		return PortBlock{}, false
+	}
+	block, ok := blocks[path]
+	return block, ok
+}
+
+// releasePorts frees the block reserved for the worktree at path
+func (m *Manager) releasePorts(ctx context.Context, path string) error {
+	return m.updatePorts(ctx, func(blocks map[string]PortBlock) error {
+		delete(blocks, path)
+		return nil
+	})
+}
+
+// updatePorts applies update to the port assignments under a lock of their
+// own, which concurrent wt processes in any repository respect
+func (m *Manager) updatePorts(ctx context.Context, update func(map[string]PortBlock) error) error {
+	dir := filepath.Join(m.BaseDir, StateDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to record ports: %w", err)
+	}
+	unlock, err := m.lockPath(ctx, filepath.Join(dir, portsLockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	blocks, err := m.readPorts()
+	if err != nil {
+		return err
+	}
+	if err := update(blocks); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(blocks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.portsPath(), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to record ports: %w", err)
+	}
+	return nil
+}
+
+// readPorts returns the port blocks reserved so far, keyed by worktree path
+func (m *Manager) readPorts() (map[string]PortBlock, error) {
+	blocks := map[string]PortBlock{}
+	data, err := os.ReadFile(m.portsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return blocks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ports: %w", err)
+	}
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, fmt.Errorf("failed to parse ports %s: %w", m.portsPath(), err)
+	}
+	return blocks, nil
+}
+
+// reserved reports whether block overlaps one already assigned
+func reserved(blocks map[string]PortBlock, block PortBlock) bool {
+	for _, b := range blocks {
+		if b.overlaps(block) {
+			return true
+		}
+	}
+	return false
+}
+
+// portsFree reports whether every port in block can be listened on, so
+// that no session is handed a port some other program already uses
+func portsFree(block PortBlock) bool {
+	for port := block.First; port <= block.Last(); port++ {
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			return false
+		}
+		_ = l.Close()
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("4000-4999", 10)
+	if err != nil {
+		t.Fatalf("ParsePortRange() error: %v", err)
+	}
+	if r != (PortRange{First: 4000, Last: 4999, Block: 10}) {
+		t.Errorf("ParsePortRange() = %+v", r)
+	}
+
+	if r, err := ParsePortRange("", 10); err != nil || r.Block != 0 {
+		t.Errorf("ParsePortRange(\"\") = %+v, %v, want the zero range", r, err)
+	}
+	for _, s := range []string{"4000", "4999-4000", "0-10", "4000-70000", "a-b"} {
+		if _, err := ParsePortRange(s, 10); err == nil {
+			t.Errorf("ParsePortRange(%q) should fail", s)
+		}
+	}
+	if _, err := ParsePortRange("4000-4004", 10); err == nil {
+		t.Error("a block larger than the range should fail")
+	}
+}
+
+func TestPortBlockEnv(t *testing.T) {
+	want := []string{"WT_PORT=4010", "WT_PORT_LAST=4019", "PORT=4010"}
+	if got := (PortBlock{First: 4010, Count: 10}).Env(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Env() = %q, want %q", got, want)
+	}
+	if got := (PortBlock{}).Env(); got != nil {
+		t.Errorf("zero block Env() = %q, want none", got)
+	}
+}
+
+// newPortSession returns a session whose worktree exists, as allocation
+// reclaims the ports of missing ones
+func newPortSession(t *testing.T, m *Manager, name string) *Session {
+	t.Helper()
+	s := &Session{Name: name, Path: m.WorktreePath("myrepo", name)}
+	if err := os.MkdirAll(s.Path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestManagerPorts(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.PortRange = PortRange{First: 47100, Last: 47139, Block: 10}
+	alpha := newPortSession(t, m, "alpha")
+	beta := newPortSession(t, m, "beta")
+
+	a, err := m.Ports(t.Context(), alpha)
+	if err != nil {
+		t.Fatalf("Ports(alpha) error: %v", err)
+	}
+	b, err := m.Ports(t.Context(), beta)
+	if err != nil {
+		t.Fatalf("Ports(beta) error: %v", err)
+	}
+	if a.Count != 10 || b.Count != 10 || a.overlaps(b) {
+		t.Errorf("blocks %s and %s should be separate blocks of 10", a, b)
+	}
+	if again, _ := m.Ports(t.Context(), alpha); again != a {
+		t.Errorf("Ports(alpha) again = %s, want the same %s", again, a)
+	}
+	if got, ok := m.AssignedPorts(beta.Path); !ok || got != b {
+		t.Errorf("AssignedPorts(beta) = %s, %v, want %s", got, ok, b)
+	}
+}
+
+func TestManagerPortsSkipsPortsInUse(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.PortRange = PortRange{First: 47140, Last: 47159, Block: 10}
+	l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(47145))
+	if err != nil {
+		t.Skipf("can't listen on the test port: %v", err)
+	}
+	defer l.Close()
+
+	block, err := m.Ports(t.Context(), newPortSession(t, m, "alpha"))
+	if err != nil {
+		t.Fatalf("Ports() error: %v", err)
+	}
+	if block.First != 47150 {
+		t.Errorf("Ports() = %s, want 47150-47159 past the port in use", block)
+	}
+
+	if _, err := m.Ports(t.Context(), newPortSession(t, m, "beta")); err == nil {
+		t.Error("Ports() should fail once the range is used up")
+	}
+}
+
+func TestManagerPortsReclaimsRemovedSessions(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.PortRange = PortRange{First: 47160, Last: 47169, Block: 10}
+	alpha := newPortSession(t, m, "alpha")
+	if _, err := m.Ports(t.Context(), alpha); err != nil {
+		t.Fatalf("Ports(alpha) error: %v", err)
+	}
+
+	// A worktree removed without wt rm no longer holds its ports
+	if err := os.RemoveAll(alpha.Path); err != nil {
+		t.Fatal(err)
+	}
+	block, err := m.Ports(t.Context(), newPortSession(t, m, "beta"))
+	if err != nil {
+		t.Fatalf("Ports(beta) error: %v", err)
+	}
+	if block.First != 47160 {
+		t.Errorf("Ports(beta) = %s, want the block alpha left", block)
+	}
+}
+
+func TestManagerRemoveReleasesPorts(t *testing.T) {
+	m, runner := newTestManager(t)
+	m.PortRange = PortRange{First: 47170, Last: 47179, Block: 10}
+	stubWorktrees(m, runner, "feature")
+	if _, err := m.Ports(t.Context(), newPortSession(t, m, "feature")); err != nil {
+		t.Fatalf("Ports() error: %v", err)
+	}
+
+	if err := m.Remove(t.Context(), "feature", false); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	if block, ok := m.AssignedPorts(m.WorktreePath("myrepo", "feature")); ok {
+		t.Errorf("removed session still holds ports %s", block)
+	}
+}
@@ -0,0 +1,176 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/emilrex/wt/internal/proc"
+)
+
+const (
+	agentLogFile  = "agent.log"
+	agentPIDFile  = "agent.pid"
+	agentExitFile = "agent.exit"
+	agentLockFile = "agent.lock"
+)
+
+// RunFiles are where an agent run records its PID and outcome, in the
+// session's state directory. Runs in a terminal share them with background
+// runs, so that wt knows whether any agent is working in the session.
+type RunFiles struct {
+	// Log receives the stdout and stderr of a background run
+	Log string
+	// PID holds the process ID of the run
+	PID string
+	// Exit holds the run's exit status once it has finished
+	Exit string
+}
+
+// RunFiles returns the files of the agent run of the session at worktreePath
+func (m *Manager) RunFiles(worktreePath string) RunFiles {
+	dir := m.StateDir(worktreePath)
+	return RunFiles{
+		Log:  filepath.Join(dir, agentLogFile),
+		PID:  filepath.Join(dir, agentPIDFile),
+		Exit: filepath.Join(dir, agentExitFile),
+	}
+}
+
+// LockAgent takes the agent lock of the session at worktreePath, without
+// waiting, before an agent is started there. It fails with ErrAgentRunning
+// while another agent holds it. The lock lasts as long as any process has
+// the returned file open: passing it to the agent, e.g. in
+// exec.Cmd.ExtraFiles, holds it for the agent's lifetime, after which wt
+// can close its own copy.
+func (m *Manager) LockAgent(worktreePath string) (*os.File, error) {
+	dir := m.StateDir(worktreePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session state directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, agentLockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open agent lock: %w", err)
+	}
+	ok, err := tryLockFile(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to take agent lock: %w", err)
+	}
+	if !ok {
+		_ = f.Close()
+		return nil, ErrAgentRunning
+	}
+	return f, nil
+}
+
+// agentLocked reports whether an agent holds the agent lock of the session
+// at worktreePath
+func (m *Manager) agentLocked(worktreePath string) bool {
+	f, err := os.Open(filepath.Join(m.StateDir(worktreePath), agentLockFile))
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	ok, err := tryLockFile(f)
+	return err == nil && !ok
+}
+
+// RunStatus describes the latest agent run in a session
+type RunStatus struct {
+	// PID is zero if no agent has run in the session
+	PID     int
+	Running bool
+	// Exited is set once the run has finished and recorded ExitCode. A run
+	// that is neither Running nor Exited was killed.
+	Exited   bool
+	ExitCode int
+}
+
+// RunStatus reports on the latest agent run in the session at worktreePath.
+// A run is only Running while its agent holds the agent lock: a recorded PID
+// without an exit status may outlive its agent, e.g. after a kill -9 or a
+// reboot, and be reused by an unrelated process.
+func (m *Manager) RunStatus(worktreePath string) (RunStatus, error) {
+	var status RunStatus
+	files := m.RunFiles(worktreePath)
+
+	pid, err := readInt(files.PID)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read agent PID: %w", err)
+	}
+	status.PID = pid
+
+	code, err := readInt(files.Exit)
+	switch {
+	case err == nil:
+		status.Exited = true
+		status.ExitCode = code
+	case errors.Is(err, os.ErrNotExist):
+		status.Running = proc.Alive(pid) && m.agentLocked(worktreePath)
+	default:
+		return status, fmt.Errorf("failed to read agent exit status: %w", err)
+	}
+	return status, nil
+}
+
+// String describes the run as "running", "idle" (no agent has run),
+// "exited(code)" or "killed"
+func (s RunStatus) String() string {
+	switch {
+	case s.Running:
+		return "running"
+	case s.Exited:
+		return fmt.Sprintf("exited(%d)", s.ExitCode)
+	case s.PID != 0:
+		return "killed"
+	default:
+		return "idle"
+	}
+}
+
+// ClearRun forgets the previous agent run in the session at worktreePath;
+// call it before starting a new one, so that an early exit of the new run
+// is not lost, nor the old PID taken for the new one's
+func (m *Manager) ClearRun(worktreePath string) error {
+	files := m.RunFiles(worktreePath)
+	for _, file := range []string{files.Exit, files.PID} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear agent run: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordStart notes that an agent with the given PID started in the session
+// at worktreePath
+func (m *Manager) RecordStart(worktreePath string, pid int) error {
+	if err := writeFileAtomic(m.RunFiles(worktreePath).PID, []byte(strconv.Itoa(pid)+"\n")); err != nil {
+		return fmt.Errorf("failed to record agent PID: %w", err)
+	}
+	return nil
+}
+
+// RecordExit notes that the agent in the session at worktreePath exited
+// with code
+func (m *Manager) RecordExit(worktreePath string, code int) error {
+	if err := writeFileAtomic(m.RunFiles(worktreePath).Exit, []byte(strconv.Itoa(code)+"\n")); err != nil {
+		return fmt.Errorf("failed to record agent exit status: %w", err)
+	}
+	return nil
+}
+
+// readInt reads a file holding a single integer
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
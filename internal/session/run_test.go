@@ -0,0 +1,126 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRunStatus(t *testing.T) {
+	m, _ := newTestManager(t)
+	path := m.WorktreePath("myrepo", "ci")
+	files := m.RunFiles(path)
+	if err := os.MkdirAll(filepath.Dir(files.PID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(file string, n int) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(strconv.Itoa(n)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status, err := m.RunStatus(path); err != nil || status != (RunStatus{}) {
+		t.Errorf("RunStatus() without a run = %+v, %v", status, err)
+	}
+
+	// A live PID may have been reused since its agent was killed
+	write(files.PID, os.Getpid())
+	if status, err := m.RunStatus(path); err != nil || status.Running || status.String() != "killed" {
+		t.Errorf("RunStatus() with a live PID but no agent lock = %+v, %v; want killed", status, err)
+	}
+	lock, err := m.LockAgent(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The agent holds the lock in another process, not through this one
+	held := exec.Command("sleep", "30")
+	held.ExtraFiles = []*os.File{lock}
+	if err := held.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.Close()
+	t.Cleanup(func() { _ = held.Process.Kill(); _ = held.Wait() })
+	if status, err := m.RunStatus(path); err != nil || !status.Running {
+		t.Errorf("RunStatus() with a live PID holding the lock = %+v, %v; want running", status, err)
+	}
+
+	write(files.PID, deadPID)
+	if status, err := m.RunStatus(path); err != nil || status.Running || status.Exited {
+		t.Errorf("RunStatus() of a killed run = %+v, %v; want neither running nor exited", status, err)
+	}
+
+	write(files.Exit, 3)
+	if status, err := m.RunStatus(path); err != nil || !status.Exited || status.ExitCode != 3 {
+		t.Errorf("RunStatus() of a finished run = %+v, %v; want exit code 3", status, err)
+	}
+}
+
+func TestRunStatusString(t *testing.T) {
+	tests := map[RunStatus]string{
+		{}:                                  "idle",
+		{PID: 1, Running: true}:             "running",
+		{PID: 1, Exited: true}:              "exited(0)",
+		{PID: 1, Exited: true, ExitCode: 2}: "exited(2)",
+		{PID: 1}:                            "killed",
+	}
+	for status, want := range tests {
+		if got := status.String(); got != want {
+			t.Errorf("%+v.String() = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestRecordRun(t *testing.T) {
+	m, _ := newTestManager(t)
+	path := m.WorktreePath("myrepo", "ci")
+	if err := os.MkdirAll(m.StateDir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RecordStart(path, deadPID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RecordExit(path, 1); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := m.RunStatus(path); status.String() != "exited(1)" {
+		t.Errorf("RunStatus() = %v, want exited(1)", status)
+	}
+
+	if err := m.ClearRun(path); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := m.RunStatus(path); status.String() != "idle" {
+		t.Errorf("RunStatus() after ClearRun = %v, want idle", status)
+	}
+}
+
+func TestLockAgent(t *testing.T) {
+	m, _ := newTestManager(t)
+	path := m.WorktreePath("myrepo", "ci")
+
+	lock, err := m.LockAgent(path)
+	if err != nil {
+		t.Fatalf("LockAgent() error: %v", err)
+	}
+	if _, err := m.LockAgent(path); !errors.Is(err, ErrAgentRunning) {
+		t.Errorf("second LockAgent() error = %v, want ErrAgentRunning", err)
+	}
+	if !m.agentLocked(path) {
+		t.Error("agentLocked() should see the held lock")
+	}
+
+	_ = lock.Close()
+	if m.agentLocked(path) {
+		t.Error("agentLocked() after the holder closed it")
+	}
+	lock, err = m.LockAgent(path)
+	if err != nil {
+		t.Fatalf("LockAgent() after release error: %v", err)
+	}
+	_ = lock.Close()
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Session selectors accepted by Find in place of a name
+const (
+	// SelectLast picks the most recently used session
+	SelectLast = "-"
+	// SelectPrevious picks the session used before the most recent one
+	SelectPrevious = "@prev"
+	// SelectCurrent picks the session containing the current directory
+	SelectCurrent = "@"
+)
+
+// selectSession resolves query if it's a selector rather than a name; ok
+// reports whether it is
+func (m *Manager) selectSession(ctx context.Context, query string, sessions []Session) (s *Session, ok bool, err error) {
+	switch query {
+	case SelectLast:
+		s, err = m.recent(ctx, sessions, 0)
+		return s, true, err
+	case SelectPrevious:
+		s, err = m.recent(ctx, sessions, 1)
+		return s, true, err
+	case SelectCurrent:
+		s, err = current(sessions)
+		return s, true, err
+	}
+
+	i, convErr := strconv.Atoi(query)
+	if convErr != nil || strings.HasPrefix(query, "+") {
+		return nil, false, nil
+	}
+	if i < 1 || i > len(sessions) {
+		return nil, true, fmt.Errorf("%w: no session #%d (wt ls lists %d)", ErrNotFound, i, len(sessions))
+	}
+	return &sessions[i-1], true, nil
+}
+
+// recent returns the nth most recently used session that still exists
+func (m *Manager) recent(ctx context.Context, sessions []Session, n int) (*Session, error) {
+	names, err := m.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		for _, s := range sessions {
+			if s.Name != name {
+				continue
+			}
+			if n == 0 {
+				return &s, nil
+			}
+			n--
+		}
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no session has been used yet", ErrNotFound)
+	}
+	return nil, fmt.Errorf("%w: no session was used before the last one", ErrNotFound)
+}
+
+// current returns the session whose worktree holds the current directory
+func current(sessions []Session) (*Session, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	cwd = realPath(cwd)
+	for _, s := range sessions {
+		path := realPath(s.Path)
+		if cwd == path || strings.HasPrefix(cwd, path+string(filepath.Separator)) {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s is not inside a session", ErrNotFound, cwd)
+}
+
+// realPath resolves symlinks in path where possible
+func realPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
@@ -1,13 +1,17 @@
 package session
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/proc"
 )
 
 const (
@@ -20,6 +24,31 @@ type Session struct {
 	Name   string
 	Branch string
 	Path   string
+	Meta   Metadata
+}
+
+// Manager creates, finds and removes the sessions of one repository
+type Manager struct {
+	Git *git.Repo
+	// BaseDir is the directory holding all worktrees
+	BaseDir string
+	// Out receives progress messages
+	Out io.Writer
+	// LockTimeout bounds how long to wait for another wt process working on
+	// the same repository; zero waits forever
+	LockTimeout time.Duration
+	// PortRange is where sessions' port blocks come from; the zero value
+	// allocates none
+	PortRange PortRange
+}
+
+// NewManager returns a Manager using the default worktree base directory
+func NewManager(repo *git.Repo, out io.Writer) (*Manager, error) {
+	baseDir, err := GetWorktreeBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{Git: repo, BaseDir: baseDir, Out: out}, nil
 }
 
 // GetWorktreeBaseDir returns the base directory for all worktrees
@@ -31,9 +60,12 @@ func GetWorktreeBaseDir() (string, error) {
 	return filepath.Join(home, WorktreeBaseDir), nil
 }
 
+// timestampFormat is the layout of timestamp-based session names
+const timestampFormat = "20060102-150405"
+
 // GenerateSessionName creates a timestamp-based session name
 func GenerateSessionName() string {
-	return time.Now().Format("20060102-150405")
+	return time.Now().Format(timestampFormat)
 }
 
 // GetBranchName returns the branch name for a session
@@ -46,28 +78,19 @@ func GetSessionFromBranch(branch string) string {
 	return strings.TrimPrefix(branch, BranchPrefix)
 }
 
-// GetWorktreePath returns the worktree path for a session
-func GetWorktreePath(repoName, sessionName string) (string, error) {
-	baseDir, err := GetWorktreeBaseDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(baseDir, fmt.Sprintf("%s-%s", repoName, sessionName)), nil
+// WorktreePath returns the worktree path for a session
+func (m *Manager) WorktreePath(repoName, sessionName string) string {
+	return filepath.Join(m.BaseDir, fmt.Sprintf("%s-%s", repoName, dirName(sessionName)))
 }
 
 // List returns all sessions for the current repository
-func List() ([]Session, error) {
-	repoName, err := git.GetRepoName()
+func (m *Manager) List(ctx context.Context) ([]Session, error) {
+	repoName, err := m.Git.GetRepoName(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	worktrees, err := git.ListWorktrees()
-	if err != nil {
-		return nil, err
-	}
-
-	baseDir, err := GetWorktreeBaseDir()
+	worktrees, err := m.Git.ListWorktrees(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -77,177 +100,232 @@ func List() ([]Session, error) {
 
 	for _, wt := range worktrees {
 		// Check if this worktree is in our base dir and matches our repo
-		if !strings.HasPrefix(wt.Path, baseDir) {
+		if !strings.HasPrefix(wt.Path, m.BaseDir) {
 			continue
 		}
 
-		dirName := filepath.Base(wt.Path)
-		if !strings.HasPrefix(dirName, prefix) {
+		dir := filepath.Base(wt.Path)
+		if !strings.HasPrefix(dir, prefix) {
 			continue
 		}
 
 		// Derive session name from directory, not branch
 		// This makes sessions resilient to branch renames
-		sessionName := strings.TrimPrefix(dirName, prefix)
+		sessionName := nameFromDir(strings.TrimPrefix(dir, prefix))
+		meta, err := m.LoadMetadata(wt.Path)
+		if err != nil {
+			m.printf("Warning: session '%s': %v\n", sessionName, err)
+		}
 		sessions = append(sessions, Session{
 			Name:   sessionName,
 			Branch: wt.Branch,
 			Path:   wt.Path,
+			Meta:   meta,
 		})
 	}
 
 	return sessions, nil
 }
 
-// Find finds a session by name with partial matching support.
-// If an exact match exists, it's returned. Otherwise, if exactly one
-// session has a name starting with the query, that session is returned.
-// If multiple sessions match, an error listing them is returned.
-func Find(name string) (*Session, error) {
-	sessions, err := List()
+// Find finds a session by name or selector, with partial matching support.
+// The selectors are a number, indexing the sessions as listed by wt ls; "-",
+// the most recently used session; "@prev", the one used before it; and "@",
+// the session whose worktree holds the current directory. A session
+// whose name or branch is exactly the query is returned outright. Otherwise
+// sessions are ranked by how the query, ignoring case, matches them: a prefix
+// of the name beats a substring of it, then of the branch, then of a tag,
+// then the name's letters in order, then a substring of the prompt. The
+// single best match is returned; if several tie, an *AmbiguousError listing
+// them is.
+func (m *Manager) Find(ctx context.Context, name string) (*Session, error) {
+	s, _, err := m.find(ctx, name)
+	return s, err
+}
+
+// FindStrict is Find for commands that destroy a session: besides an exact
+// name or branch and a selector, it accepts only a prefix of one session's
+// name. A weaker match is returned with a *LooseMatchError, for the caller
+// to confirm.
+func (m *Manager) FindStrict(ctx context.Context, name string) (*Session, error) {
+	s, r, err := m.find(ctx, name)
+	if err == nil && r < prefixMatch {
+		return s, &LooseMatchError{Query: name, Session: *s}
+	}
+	return s, err
+}
+
+// find implements Find, also returning how well the session matched
+func (m *Manager) find(ctx context.Context, name string) (*Session, matchRank, error) {
+	sessions, err := m.List(ctx)
 	if err != nil {
-		return nil, err
+		return nil, noMatch, err
 	}
 
 	// First, try exact match
 	for _, s := range sessions {
-		if s.Name == name {
-			return &s, nil
+		if s.Name == name || s.Branch == name {
+			return &s, exactMatch, nil
 		}
 	}
+	if s, ok, err := m.selectSession(ctx, name, sessions); ok {
+		return s, exactMatch, err
+	}
 
-	// Try prefix match
+	query := strings.ToLower(name)
+	best := noMatch
 	var matches []Session
 	for _, s := range sessions {
-		if strings.HasPrefix(s.Name, name) {
-			matches = append(matches, s)
+		r := rank(query, s)
+		if r == noMatch || r < best {
+			continue
 		}
+		if r > best {
+			best, matches = r, nil
+		}
+		matches = append(matches, s)
 	}
 
 	if len(matches) == 0 {
-		return nil, fmt.Errorf("session '%s' not found", name)
+		return nil, noMatch, fmt.Errorf("%w: '%s'", ErrNotFound, name)
 	}
 
 	if len(matches) == 1 {
-		return &matches[0], nil
+		return &matches[0], best, nil
 	}
 
-	// Multiple matches - list them in the error
-	var names []string
-	for _, m := range matches {
-		names = append(names, m.Name)
+	// List the most recently used first, as the likeliest to be meant
+	lastUsed := make(map[string]time.Time, len(matches))
+	for _, s := range matches {
+		lastUsed[s.Name] = m.LastActivity(&s)
+	}
+	slices.SortStableFunc(matches, func(a, b Session) int {
+		return lastUsed[b.Name].Compare(lastUsed[a.Name])
+	})
+	ambiguous := &AmbiguousError{Query: name, Matches: matches}
+	for _, s := range matches {
+		ambiguous.LastUsed = append(ambiguous.LastUsed, lastUsed[s.Name])
 	}
-	return nil, fmt.Errorf("'%s' matches multiple sessions: %s", name, strings.Join(names, ", "))
+	return nil, best, ambiguous
 }
 
-// Create creates a new session
-func Create(name, sourceBranch string) (*Session, error) {
-	repoName, err := git.GetRepoName()
+// Remove removes a session, which name must match exactly or as a unique
+// prefix of its name (see FindStrict), discarding uncommitted changes. Unless
+// force is set, sessions whose submodules have unpushed commits are left
+// alone and ErrUnpushedSubmodule is returned, as ErrAgentRunning is for those
+// with a running agent.
+func (m *Manager) Remove(ctx context.Context, name string, force bool) error {
+	unlock, err := m.lockRepo(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer unlock()
 
-	// Ensure base directory exists
-	baseDir, err := GetWorktreeBaseDir()
-	if err != nil {
-		return nil, err
-	}
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create worktree base directory: %w", err)
+	// Clean up after any wt that was killed while creating a session
+	if err := m.recover(ctx); err != nil {
+		return err
 	}
+	return m.remove(ctx, name, force)
+}
 
-	branchName := GetBranchName(name)
-	worktreePath, err := GetWorktreePath(repoName, name)
+// remove removes a session; the caller holds the repository lock
+func (m *Manager) remove(ctx context.Context, name string, force bool) error {
+	session, err := m.FindStrict(ctx, name)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Check if worktree already exists
-	if _, err := os.Stat(worktreePath); err == nil {
-		return nil, fmt.Errorf("session '%s' already exists at %s", name, worktreePath)
+	// Commits in a submodule exist only in the session's own clone of it,
+	// which goes with the worktree
+	if !force && hasSubmodules(session.Path) {
+		unpushed, err := m.Git.UnpushedSubmodules(ctx, session.Path)
+		if err != nil {
+			return err
+		}
+		if len(unpushed) > 0 {
+			return fmt.Errorf("session '%s': %w in %s (push them or use --force to remove anyway)", session.Name, ErrUnpushedSubmodule, strings.Join(unpushed, ", "))
+		}
 	}
 
-	// Fetch and fast-forward source branch
-	fmt.Println("Fetching from origin...")
-	if err := git.FetchOrigin(); err != nil {
-		// Non-fatal: might not have a remote
-		fmt.Printf("Warning: %v\n", err)
+	// Don't pull the worktree out from under an agent, whether it recorded
+	// its PID or only holds the agent lock, as one still starting does
+	run, err := m.RunStatus(session.Path)
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("Updating %s...\n", sourceBranch)
-	if err := git.FastForwardBranch(sourceBranch); err != nil {
-		// Non-fatal: might not be fast-forwardable
-		fmt.Printf("Warning: %v\n", err)
+	if run.Running {
+		if !force {
+			return fmt.Errorf("session '%s': %w (pid %d); use --force to stop it", session.Name, ErrAgentRunning, run.PID)
+		}
+		m.printf("Stopping agent (pid %d)...\n", run.PID)
+		if err := proc.Terminate(run.PID); err != nil {
+			m.printf("Warning: failed to stop agent: %v\n", err)
+		}
+	} else if !force && m.agentLocked(session.Path) {
+		return fmt.Errorf("session '%s': %w; use --force to remove it anyway", session.Name, ErrAgentRunning)
 	}
 
-	// Verify source branch has commits
-	if !git.HasCommits(sourceBranch) {
-		return nil, fmt.Errorf("source branch '%s' has no commits", sourceBranch)
+	m.printf("Removing worktree %s...\n", session.Path)
+	if err := m.Git.RemoveWorktree(ctx, session.Path); err != nil {
+		return err
 	}
 
-	// Create branch if it doesn't exist
-	if !git.BranchExists(branchName) {
-		fmt.Printf("Creating branch %s from %s...\n", branchName, sourceBranch)
-		if err := git.CreateBranch(branchName, sourceBranch); err != nil {
-			return nil, err
-		}
-	} else {
-		fmt.Printf("Branch %s already exists, using existing branch\n", branchName)
+	if err := os.RemoveAll(m.StateDir(session.Path)); err != nil {
+		m.printf("Warning: failed to remove session state: %v\n", err)
+	}
+	if err := m.forget(ctx, session.Name); err != nil {
+		m.printf("Warning: %v\n", err)
+	}
+	if err := m.releasePorts(ctx, session.Path); err != nil {
+		m.printf("Warning: %v\n", err)
 	}
 
-	// Create worktree
-	fmt.Printf("Creating worktree at %s...\n", worktreePath)
-	if err := git.AddWorktree(worktreePath, branchName); err != nil {
-		// Clean up branch if we just created it
-		_ = git.DeleteBranch(branchName)
-		return nil, err
+	m.printf("Deleting branch %s...\n", session.Branch)
+	if err := m.Git.DeleteBranch(ctx, session.Branch); err != nil {
+		// Non-fatal: branch might have been deleted already
+		m.printf("Warning: %v\n", err)
 	}
 
-	return &Session{
-		Name:   name,
-		Branch: branchName,
-		Path:   worktreePath,
-	}, nil
+	return nil
 }
 
-// Remove removes a session
-func Remove(name string) error {
-	session, err := Find(name)
+// RemoveAll removes all sessions for the current repository. Sessions that
+// fail to be removed, e.g. ones with a running agent without force, are
+// skipped with a warning, and a *SkippedError lists them afterwards.
+func (m *Manager) RemoveAll(ctx context.Context, force bool) error {
+	unlock, err := m.lockRepo(ctx)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	fmt.Printf("Removing worktree %s...\n", session.Path)
-	if err := git.RemoveWorktree(session.Path); err != nil {
+	if err := m.recover(ctx); err != nil {
 		return err
 	}
 
-	fmt.Printf("Deleting branch %s...\n", session.Branch)
-	if err := git.DeleteBranch(session.Branch); err != nil {
-		// Non-fatal: branch might have been deleted already
-		fmt.Printf("Warning: %v\n", err)
-	}
-
-	return nil
-}
-
-// RemoveAll removes all sessions for the current repository
-func RemoveAll() error {
-	sessions, err := List()
+	sessions, err := m.List(ctx)
 	if err != nil {
 		return err
 	}
 
 	if len(sessions) == 0 {
-		fmt.Println("No sessions to remove")
+		m.printf("No sessions to remove\n")
 		return nil
 	}
 
+	skipped := &SkippedError{Total: len(sessions)}
 	for _, s := range sessions {
-		if err := Remove(s.Name); err != nil {
-			fmt.Printf("Warning: failed to remove session '%s': %v\n", s.Name, err)
+		if err := m.remove(ctx, s.Name, force); err != nil {
+			m.printf("Warning: failed to remove session '%s': %v\n", s.Name, err)
+			skipped.Names = append(skipped.Names, s.Name)
+			skipped.Errs = append(skipped.Errs, err)
 		}
 	}
-
+	if len(skipped.Names) > 0 {
+		return skipped
+	}
 	return nil
 }
+
+func (m *Manager) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(m.Out, format, args...)
+}
@@ -1,7 +1,10 @@
 package session
 
 import (
+	"errors"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -55,3 +58,90 @@ func TestGetSessionFromBranch(t *testing.T) {
 		}
 	}
 }
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query, s string
+		want     bool
+	}{
+		{"", "anything", true},
+		{"auth", "auth-feature", true},
+		{"af", "auth-feature", true},
+		{"AF", "auth-feature", true},
+		{"ra", "auth-feature", false},
+		{"authx", "auth-feature", false},
+	}
+	for _, tt := range tests {
+		if got := FuzzyMatch(tt.query, tt.s); got != tt.want {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, want %v", tt.query, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	valid := []string{"feature", "auth/login", "fix-123", "v1.2", "20241215-143022", "a_b+c"}
+	for _, name := range valid {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) error: %v", name, err)
+		}
+	}
+
+	invalid := []string{
+		"", "../../tmp/x", "/abs", "auth/", "a//b", ".hidden", "a/.b", "x.lock", "end.",
+		"has space", "tab\there", "~home", "a^b", "a:b", "a?b", "a*b", "a[b", `a\b`, "a@{1}",
+		"-flag", "@", "@prev", "42", strings.Repeat("a", maxNameLength+1),
+	}
+	for _, name := range invalid {
+		if err := ValidateName(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("ValidateName(%q) = %v, want ErrInvalidName", name, err)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Fix the Login Bug!":   "fix-the-login-bug",
+		"  ../../tmp/x ":       "tmp/x",
+		"Auth / Login flow":    "auth/login-flow",
+		"JIRA-123: crash on ~": "jira-123-crash-on",
+		"café déjà vu":         "caf-d-j-vu",
+		"snake_case stays":     "snake_case-stays",
+		"!!!":                  "",
+		"x.lock":               "x-lock",
+		"--flag":               "flag",
+		"@prev":                "prev",
+		"a//b":                 "a/b",
+	}
+	for input, want := range tests {
+		got := Slugify(input)
+		if got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", input, got, want)
+		}
+		if got != "" {
+			if err := ValidateName(got); err != nil {
+				t.Errorf("Slugify(%q) = %q, which is invalid: %v", input, got, err)
+			}
+		}
+	}
+
+	if got := Slugify(strings.Repeat("ab ", 60)); len(got) > maxNameLength || ValidateName(got) != nil {
+		t.Errorf("Slugify of a long title = %q, want a valid name of at most %d characters", got, maxNameLength)
+	}
+}
+
+func TestCleanSparsePaths(t *testing.T) {
+	got, err := CleanSparsePaths([]string{"services/api/", "./libs", "libs", `docs\guide`})
+	if err != nil {
+		t.Fatalf("CleanSparsePaths() error: %v", err)
+	}
+	want := []string{"services/api", "libs", "docs/guide"}
+	if !slices.Equal(got, want) {
+		t.Errorf("CleanSparsePaths() = %q, want %q", got, want)
+	}
+
+	for _, path := range []string{".", "", "/etc", "../sibling", "a/../.."} {
+		if _, err := CleanSparsePaths([]string{path}); err == nil {
+			t.Errorf("CleanSparsePaths(%q) should fail", path)
+		}
+	}
+}
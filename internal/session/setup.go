@@ -0,0 +1,44 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Setup runs commands, one by one, in the new session's worktree, e.g. to
+// install dependencies. Each runs with sh -c and sees the session name in
+// WT_SESSION, the original repository in WT_REPO_ROOT and the session's
+// ports, if any, in PORT, WT_PORT and WT_PORT_LAST. It stops at the first
+// command that fails.
+func (c *Creation) Setup(ctx context.Context, commands []string, out io.Writer) error {
+	var ports PortBlock
+	if len(commands) > 0 {
+		var err error
+		if ports, err = c.m.Ports(ctx, c.Session); err != nil {
+			_, _ = fmt.Fprintf(out, "Warning: %v\n", err)
+		}
+	}
+	for _, command := range commands {
+		_, _ = fmt.Fprintf(out, "Running setup in '%s': %s\n", c.Session.Name, command)
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Dir = c.Session.Path
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = append(os.Environ(),
+			"WT_SESSION="+c.Session.Name,
+			"WT_REPO_ROOT="+c.journal.RepoRoot,
+		)
+		cmd.Env = append(cmd.Env, ports.Env()...)
+		if err := cmd.Run(); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("setup command %q failed in session '%s': %w", command, c.Session.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// CleanSparsePaths checks and normalizes the directories of a sparse
+// checkout: they must be relative to the repository root and stay inside
+// it. Trailing slashes and "./" are dropped, and duplicates removed.
+func CleanSparsePaths(paths []string) ([]string, error) {
+	var cleaned []string
+	for _, p := range paths {
+		c := path.Clean(strings.ReplaceAll(strings.TrimSpace(p), `\`, "/"))
+		switch {
+		case c == ".":
+			return nil, fmt.Errorf("invalid sparse path %q: name a directory, not the repository root", p)
+		case path.IsAbs(c):
+			return nil, fmt.Errorf("invalid sparse path %q: it must be relative to the repository root", p)
+		case c == ".." || strings.HasPrefix(c, "../"):
+			return nil, fmt.Errorf("invalid sparse path %q: it must stay inside the repository", p)
+		}
+		if !slices.Contains(cleaned, c) {
+			cleaned = append(cleaned, c)
+		}
+	}
+	return cleaned, nil
+}
+
+// SparseAdd widens the sparse checkout of s to include paths, and records
+// them in its metadata
+func (m *Manager) SparseAdd(ctx context.Context, s *Session, paths []string) error {
+	paths, err := CleanSparsePaths(paths)
+	if err != nil {
+		return err
+	}
+	_, sparse, err := m.Git.SparsePaths(ctx, s.Path)
+	if err != nil {
+		return err
+	}
+	if !sparse {
+		return fmt.Errorf("%w: '%s' already has every directory", ErrNotSparse, s.Name)
+	}
+	if err := m.Git.SparseAdd(ctx, s.Path, paths); err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		if !slices.Contains(s.Meta.Sparse, p) {
+			s.Meta.Sparse = append(s.Meta.Sparse, p)
+		}
+	}
+	return m.SaveMetadata(s.Path, s.Meta)
+}
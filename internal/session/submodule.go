@@ -0,0 +1,59 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/emilrex/wt/internal/git"
+)
+
+// hasSubmodules reports whether the worktree at path declares submodules
+func hasSubmodules(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".gitmodules"))
+	return err == nil
+}
+
+// updateSubmodules checks out the submodules of a new session's worktree.
+// Each copies objects from the main checkout's clone of it, when there is
+// one, so only commits the main checkout lacks are fetched. Failures are
+// only warnings: the session is still usable, and the update can be retried
+// by hand.
+func (m *Manager) updateSubmodules(ctx context.Context, worktreePath string) error {
+	if !hasSubmodules(worktreePath) {
+		return nil
+	}
+	submodules, err := m.Git.Submodules(ctx, worktreePath)
+	if err == nil && len(submodules) > 0 {
+		m.printf("Updating submodules...\n")
+		err = m.updateSubmodulesFrom(ctx, worktreePath, submodules)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		m.printf("Warning: %v\n", err)
+		m.printf("Run `git submodule update --init --recursive` in the session to retry\n")
+	}
+	return nil
+}
+
+func (m *Manager) updateSubmodulesFrom(ctx context.Context, worktreePath string, submodules []git.Submodule) error {
+	commonDir, err := m.Git.GetCommonDir(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sub := range submodules {
+		reference := filepath.Join(commonDir, "modules", sub.Name)
+		if _, err := os.Stat(reference); err != nil {
+			continue
+		}
+		// A submodule that fails here is cloned from scratch below
+		if err := m.Git.UpdateSubmodule(ctx, worktreePath, sub.Path, reference); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	// Submodules the main checkout hasn't cloned, and those nested inside
+	// others, are fetched from their remotes
+	return m.Git.UpdateSubmodules(ctx, worktreePath)
+}
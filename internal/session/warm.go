@@ -0,0 +1,238 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// WarmStrategy is how a warm directory is cloned from the main checkout
+type WarmStrategy string
+
+const (
+	// WarmReflink makes a copy-on-write clone, which shares disk blocks
+	// until either side changes a file. Where the filesystem can't, it
+	// falls back to WarmCopy.
+	WarmReflink WarmStrategy = "reflink"
+	// WarmHardlink links every file to the main checkout's, which only
+	// suits directories tools never modify in place. Across filesystems,
+	// it falls back to WarmCopy.
+	WarmHardlink WarmStrategy = "hardlink"
+	// WarmCopy copies every file
+	WarmCopy WarmStrategy = "copy"
+)
+
+// WarmDir is a directory, such as node_modules, that new sessions get from
+// the main checkout instead of building it again
+type WarmDir struct {
+	// Path is relative to the repository root
+	Path     string
+	Strategy WarmStrategy
+}
+
+// ParseWarmDir parses a warm directory given in config as path or
+// path:strategy; the strategy defaults to WarmReflink
+func ParseWarmDir(s string) (WarmDir, error) {
+	path, strategy, ok := strings.Cut(s, ":")
+	dir := WarmDir{Path: filepath.Clean(path), Strategy: WarmStrategy(strategy)}
+	if !ok {
+		dir.Strategy = WarmReflink
+	}
+	switch dir.Strategy {
+	case WarmReflink, WarmHardlink, WarmCopy:
+	default:
+		return dir, fmt.Errorf("invalid warm directory %q: want reflink, hardlink or copy after ':'", s)
+	}
+	if path == "" || dir.Path == "." || !filepath.IsLocal(dir.Path) {
+		return dir, fmt.Errorf("invalid warm directory %q: it must be inside the repository", s)
+	}
+	return dir, nil
+}
+
+// WarmResult describes a directory cloned into a new session
+type WarmResult struct {
+	Path string
+	// Strategy is what was actually used, after any fallback
+	Strategy WarmStrategy
+	// Size is the total size of the directory's files
+	Size int64
+	// Shared is how much of Size takes no extra disk space, because it is
+	// shared with the main checkout
+	Shared  int64
+	Elapsed time.Duration
+}
+
+// Warm clones dirs from the main checkout into the new session's worktree,
+// before setup commands run, so that e.g. `npm ci` finds node_modules
+// already in place. Directories the main checkout lacks, or the session
+// already has, are skipped. Each clone is journaled, so a rollback removes
+// it. Failures are only warnings, printed to out: setup can still build what
+// is missing.
+func (c *Creation) Warm(ctx context.Context, dirs []WarmDir, out io.Writer) ([]WarmResult, error) {
+	var results []WarmResult
+	for _, dir := range dirs {
+		src := filepath.Join(c.journal.RepoRoot, dir.Path)
+		dst := filepath.Join(c.Session.Path, dir.Path)
+		if _, err := os.Stat(src); err != nil {
+			_, _ = fmt.Fprintf(out, "Skipping warm directory %s: not in the main checkout\n", dir.Path)
+			continue
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			_, _ = fmt.Fprintf(out, "Skipping warm directory %s: the session already has it\n", dir.Path)
+			continue
+		}
+
+		_, _ = fmt.Fprintf(out, "Cloning %s from the main checkout (%s)...\n", dir.Path, dir.Strategy)
+		var result WarmResult
+		err := c.TrackPath(dst, func() (err error) {
+			result, err = cloneDir(ctx, src, dst, dir.Strategy)
+			return err
+		})
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return results, ctxErr
+			}
+			_ = os.RemoveAll(dst)
+			_, _ = fmt.Fprintf(out, "Warning: failed to clone %s: %v\n", dir.Path, err)
+			continue
+		}
+		result.Path = dir.Path
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// cloneDir clones src to dst, which must not exist, falling back to a copy
+// where strategy isn't supported
+func cloneDir(ctx context.Context, src, dst string, strategy WarmStrategy) (WarmResult, error) {
+	start := time.Now()
+	result := WarmResult{Strategy: strategy, Size: DiskUsage(src)}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return result, err
+	}
+
+	var err error
+	switch strategy {
+	case WarmReflink:
+		err = reflinkTree(ctx, src, dst)
+	case WarmHardlink:
+		err = copyTree(ctx, src, dst, true)
+	}
+	if strategy == WarmCopy || err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		_ = os.RemoveAll(dst)
+		result.Strategy = WarmCopy
+		err = copyTree(ctx, src, dst, false)
+	}
+	if result.Strategy != WarmCopy {
+		result.Shared = result.Size
+	}
+	result.Elapsed = time.Since(start)
+	return result, err
+}
+
+// reflinkTree makes a copy-on-write clone of src at dst with cp, failing
+// where the filesystem doesn't support it
+func reflinkTree(ctx context.Context, src, dst string) error {
+	args := []string{"-a", "--reflink=always", src, dst}
+	if runtime.GOOS == "darwin" {
+		// clonefile(2) through cp -c, on APFS
+		args = []string{"-c", "-R", "-p", src, dst}
+	}
+	output, err := exec.CommandContext(ctx, "cp", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyTree recreates src at dst, hard-linking or copying each file and
+// keeping modification times, which build tools use to tell what changed
+func copyTree(ctx context.Context, src, dst string, link bool) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case entry.Type()&fs.ModeSymlink != 0:
+			dest, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(dest, target)
+		case !entry.Type().IsRegular():
+			// Sockets, pipes and devices have no place in a dependency tree
+			return nil
+		case link:
+			return os.Link(path, target)
+		default:
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// DiskUsage returns the total size of the files under dir, skipping any it
+// can't read
+func DiskUsage(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseWarmDir(t *testing.T) {
+	tests := map[string]WarmDir{
+		"node_modules":        {Path: "node_modules", Strategy: WarmReflink},
+		"web/.venv/:hardlink": {Path: "web/.venv", Strategy: WarmHardlink},
+		"target:copy":         {Path: "target", Strategy: WarmCopy},
+	}
+	for input, want := range tests {
+		got, err := ParseWarmDir(input)
+		if err != nil || got != want {
+			t.Errorf("ParseWarmDir(%q) = %+v, %v, want %+v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", ".", "../cache", "/abs", "target:rsync"} {
+		if _, err := ParseWarmDir(input); err == nil {
+			t.Errorf("ParseWarmDir(%q) should fail", input)
+		}
+	}
+}
+
+func TestCloneDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "node_modules")
+	if err := os.MkdirAll(filepath.Join(src, "pkg", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(src, "pkg", "lib", "index.js")
+	if err := os.WriteFile(file, []byte("module.exports = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("lib/index.js", filepath.Join(src, "pkg", "main.js")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strategy := range []WarmStrategy{WarmReflink, WarmHardlink, WarmCopy} {
+		dst := filepath.Join(t.TempDir(), "session", "node_modules")
+		result, err := cloneDir(t.Context(), src, dst, strategy)
+		if err != nil {
+			t.Fatalf("cloneDir(%s) error: %v", strategy, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dst, "pkg", "main.js"))
+		if err != nil || string(data) != "module.exports = 1\n" {
+			t.Errorf("%s: clone should keep files and symlinks: %q, %v", strategy, data, err)
+		}
+		if info, err := os.Stat(filepath.Join(dst, "pkg", "lib", "index.js")); err != nil || !info.ModTime().Equal(old) {
+			t.Errorf("%s: clone should keep modification times: %v", strategy, err)
+		}
+		if result.Size != int64(len(data)) {
+			t.Errorf("%s: Size = %d, want %d", strategy, result.Size, len(data))
+		}
+		// Reflinks fall back to copies on filesystems without them
+		if wantShared := result.Strategy != WarmCopy; (result.Shared > 0) != wantShared {
+			t.Errorf("%s: used %s, Shared = %d", strategy, result.Strategy, result.Shared)
+		}
+		if strategy == WarmCopy && result.Strategy != WarmCopy {
+			t.Errorf("copy used %s", result.Strategy)
+		}
+	}
+}
+
+func TestWarmRollback(t *testing.T) {
+	m, runner := newTestManager(t)
+	root := t.TempDir()
+	runner.On("rev-parse --show-toplevel", root+"\n", nil)
+	if err := os.MkdirAll(filepath.Join(root, "node_modules", "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := m.Begin(t.Context(), createOpts("feature"))
+	if err != nil {
+		t.Fatalf("Begin() error: %v", err)
+	}
+	results, err := c.Warm(t.Context(), []WarmDir{{Path: "node_modules", Strategy: WarmCopy}}, io.Discard)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Warm() = %v, %v; want one clone", results, err)
+	}
+
+	// The fake git leaves the worktree in place; the journal removes the clone
+	if err := c.Rollback(t.Context()); err != nil {
+		t.Fatalf("Rollback() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Session.Path, "node_modules")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("warm directory should be rolled back: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package term puts the terminal into the modes interactive commands need
+// and reads keypresses from it. It drives stty rather than making system
+// calls, so wt stays free of dependencies.
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IsTerminal reports whether r is an interactive terminal
+func IsTerminal(r any) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Cbreak turns off line buffering, echo and signal keys on the terminal f,
+// so keypresses arrive one at a time and Ctrl-C arrives as KeyCtrlC rather
+// than interrupting. restore puts back the previous settings.
+func Cbreak(f *os.File) (restore func(), err error) {
+	saved, err := stty(f, "-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	if _, err := stty(f, "-icanon", "-echo", "-isig", "min", "1", "time", "0"); err != nil {
+		return nil, fmt.Errorf("failed to set terminal mode: %w", err)
+	}
+	return func() { _, _ = stty(f, strings.TrimSpace(saved)) }, nil
+}
+
+// Size returns the width and height of the terminal f, or 80x24 if unknown
+func Size(f *os.File) (width, height int) {
+	out, err := stty(f, "size")
+	if err == nil {
+		if _, err := fmt.Sscan(out, &height, &width); err == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+	return 80, 24
+}
+
+// stty runs stty on the terminal f
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Key is a keypress: a printable character, or one of the named keys
+type Key string
+
+const (
+	KeyUp    Key = "up"
+	KeyDown  Key = "down"
+	KeyEnter Key = "enter"
+	KeyEsc   Key = "esc"
+	KeyCtrlC Key = "ctrl-c"
+	// KeyBackspace is sent by both Backspace and Delete on most terminals
+	KeyBackspace Key = "backspace"
+)
+
+// ParseKeys splits what one read from a terminal returned into keypresses
+func ParseKeys(buf []byte) []Key {
+	var keys []Key
+	s := string(buf)
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "\x1b[A"), strings.HasPrefix(s, "\x1bOA"):
+			keys, s = append(keys, KeyUp), s[3:]
+		case strings.HasPrefix(s, "\x1b[B"), strings.HasPrefix(s, "\x1bOB"):
+			keys, s = append(keys, KeyDown), s[3:]
+		case strings.HasPrefix(s, "\x1b["):
+			// Some other escape sequence; skip it up to its final byte
+			end := strings.IndexFunc(s[2:], func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+			if end < 0 {
+				return keys
+			}
+			s = s[2+end+1:]
+		default:
+			r := []rune(s)[0]
+			s = s[len(string(r)):]
+			switch r {
+			case '\r', '\n':
+				keys = append(keys, KeyEnter)
+			case 0x1b:
+				keys = append(keys, KeyEsc)
+			case 0x03:
+				keys = append(keys, KeyCtrlC)
+			case 0x7f, 0x08:
+				keys = append(keys, KeyBackspace)
+			default:
+				keys = append(keys, Key(string(r)))
+			}
+		}
+	}
+	return keys
+}
+
+// KeyReader reads keypresses on demand. A read is only in flight after
+// Request, so nothing competes for the terminal while another program,
+// such as the agent, is using it.
+type KeyReader struct {
+	req  chan struct{}
+	keys chan Key
+}
+
+// NewKeyReader returns a KeyReader reading from r
+func NewKeyReader(r io.Reader) *KeyReader {
+	k := &KeyReader{req: make(chan struct{}, 1), keys: make(chan Key, 64)}
+	go func() {
+		defer close(k.keys)
+		buf := make([]byte, 64)
+		for range k.req {
+			// Read until something usable arrives
+			for {
+				n, err := r.Read(buf)
+				if err != nil {
+					return
+				}
+				keys := ParseKeys(buf[:n])
+				for _, key := range keys {
+					k.keys <- key
+				}
+				if len(keys) > 0 {
+					break
+				}
+			}
+		}
+	}()
+	return k
+}
+
+// Request starts reading the next keypresses, which arrive on Keys. It does
+// nothing while earlier keypresses are waiting or a read is in flight.
+func (k *KeyReader) Request() {
+	if len(k.keys) > 0 {
+		return
+	}
+	select {
+	case k.req <- struct{}{}:
+	default:
+	}
+}
+
+// Keys delivers requested keypresses; it is closed when reading fails
+func (k *KeyReader) Keys() <-chan Key {
+	return k.keys
+}
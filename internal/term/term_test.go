@@ -0,0 +1,38 @@
+package term
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := map[string][]Key{
+		"q":            {"q"},
+		"\x1b[A\x1b[B": {KeyUp, KeyDown},
+		"\x1bOA":       {KeyUp},
+		"\r\n":         {KeyEnter, KeyEnter},
+		"\x1b":         {KeyEsc},
+		"\x03\x7f":     {KeyCtrlC, KeyBackspace},
+		"\x1b[1;5Cjé":  {"j", "é"},
+		"\x1b[1;5":     nil,
+	}
+	for input, want := range tests {
+		if got := ParseKeys([]byte(input)); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseKeys(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestKeyReader(t *testing.T) {
+	k := NewKeyReader(strings.NewReader("jk"))
+	k.Request()
+	var got []Key
+	for key := range k.Keys() {
+		got = append(got, key)
+		k.Request()
+	}
+	if want := []Key{"j", "k"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
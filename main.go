@@ -1,16 +1,37 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"strings"
+	"syscall"
 
 	"github.com/emilrex/wt/internal/cmd"
+	"github.com/emilrex/wt/internal/git"
+	"github.com/emilrex/wt/internal/session"
 )
 
 var version = "dev"
 
+// Exit codes, so wrapper scripts can tell failures apart
+const (
+	exitError         = 1   // any failure not listed below
+	exitUsage         = 2   // invalid command line
+	exitNotFound      = 3   // no session matches the given name
+	exitAmbiguous     = 4   // the name matches several sessions
+	exitAlreadyExists = 5   // a session with that name already exists
+	exitNotARepo      = 6   // not run inside a git repository
+	exitDirty         = 7   // unpushed submodule commits, or uncommitted changes in the way
+	exitGitFailed     = 8   // a git command failed
+	exitLocked        = 9   // another wt process held the repository lock too long
+	exitInterrupted   = 130 // interrupted by Ctrl-C or SIGTERM
+)
+
 func init() {
 	if version == "dev" {
 		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
@@ -26,42 +47,126 @@ Usage:
 
 Commands:
   new [name] [-b branch]  Create a new worktree session and launch Claude Code
-  fg <session-name>       Resume an existing session (foreground)
+      --base remote|local Branch from origin/<branch> without touching the
+                          local branch (default), or update and use the local one
+      --offline           Don't fetch the source branch (alias --no-fetch)
+      --fetch             Fetch even if disabled in config or fetched recently
+      -n|--count N        Create sessions name-1..name-N from the same commit
+      -p|--prompt TEXT    Start the agent on this instruction
+      --prompt-file FILE  Read the instruction from FILE (- for stdin)
+      --bg                Run the agent headless in the background (needs a prompt)
+      -t|--tag TAG        Label the session to find it by; repeat for several
+      --slugify           Turn the name into a valid one, e.g. "Fix bug" into fix-bug
+      --sparse DIR        Check out only DIR and top-level files; repeat or use
+                          commas for several (default wt.sparse)
+      --no-sparse         Check out everything even if wt.sparse is set
+      --submodules        Check out submodules (default wt.submodules)
+      --no-submodules     Leave submodules uninitialized even if wt.submodules is set
+      --no-warm           Don't clone the warm directories (wt.warm)
+      --lfs POLICY        Get Git LFS files during checkout (smudge), only those
+                          in wt.lfsInclude (skip), or from the main checkout's
+                          store without downloading (share); default wt.lfs
+  fg [session-name]       Resume an existing session (foreground)
+  attach <session-name>   Switch to a session's tmux/zellij window (wt.mux)
+  run <session-name>      Run the agent headless in the background on the
+      [-p TEXT]           session's prompt, or a new one
+  logs <session-name>     Print the output of a background run
+      -f|--follow         Keep printing until the agent finishes
   ls                      List all active sessions
-  rm <session-name>       Remove a session
+  show <session-name>     Show everything known about a session
+      --json              Print as JSON
+  ui                      Dashboard of all sessions with live status
+  rm [session-name]       Remove a session
   rm -a|--all             Remove all sessions
-  cd <session-name>       Open a shell in a session's worktree
+  rm -f|--force ...       Remove even with unpushed submodule commits or a
+                          running agent
+  cd [session-name]       Open a shell in a session's worktree, with its ports
+                          (wt.ports) in PORT, WT_PORT and WT_PORT_LAST
+  sparse add <session-name> <dir>...
+                          Check out more directories in a sparse session
+  sparse list [session-name]
+                          List the directories a sparse session checks out
+
+Without a session name, fg, rm, cd and sparse list let you pick one (wt.picker).
+Instead of a name, any command taking a session accepts:
+  N                       The Nth session listed by wt ls
+  -                       The most recently used session
+  @prev                   The session used before that
+  @                       The session containing the current directory
 
 Examples:
-  wt new                       # New session with auto-generated name
+  wt new                       # New session with a generated name (wt.names)
   wt new auth-feature          # New session named 'auth-feature'
   wt new hotfix -b main        # New session from main branch
+  wt new auth/login            # Hierarchical name, on branch wt-auth/login
+  wt new spike --offline       # New session without contacting the remote
+  wt new try --count 3         # Sessions try-1, try-2 and try-3 from one commit
+  wt new fix -p "Fix the bug"  # Start the agent on an instruction
+  wt new api --sparse services/api,libs
+                               # Check out only two directories of a monorepo
+  wt sparse add api docs       # Check out docs too
+  wt new docs --prompt-file task.md
+  wt new ci -p "Fix CI" --bg   # Let the agent work in the background
+  wt logs ci -f                # Follow its output
   wt fg auth-feature           # Resume the auth-feature session
+  wt fg -                      # Resume the last session used
   wt ls                        # List all sessions
+  wt ui                        # Watch and manage sessions interactively
   wt rm auth-feature           # Remove specific session
   wt rm --all                  # Remove all sessions
   wt cd auth-feature           # Open shell in session directory
+
+Exit codes:
+  0  success
+  1  other error
+  2  invalid usage
+  3  session not found
+  4  session name is ambiguous
+  5  session already exists
+  6  not in a git repository
+  7  session has unpushed submodule commits
+  8  git command failed
+  9  timed out waiting for another wt process
+  130 interrupted
 `
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Print(usage)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
+	// Ctrl-C and SIGTERM cancel running git commands instead of killing wt
+	// outright, so it can clean up. Interactive children such as the agent
+	// receive Ctrl-C from the terminal themselves.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	command := os.Args[1]
 
 	switch command {
 	case "new":
-		runNew(os.Args[2:])
+		runNew(ctx, os.Args[2:])
 	case "fg":
-		runFg(os.Args[2:])
+		runFg(ctx, os.Args[2:])
+	case "show":
+		runShow(ctx, os.Args[2:])
+	case "attach":
+		runAttach(ctx, os.Args[2:])
+	case "run":
+		runRun(ctx, os.Args[2:])
+	case "logs":
+		runLogs(ctx, os.Args[2:])
 	case "ls":
-		runLs()
+		runLs(ctx)
+	case "ui":
+		runUI(ctx)
 	case "rm":
-		runRm(os.Args[2:])
+		runRm(ctx, os.Args[2:])
 	case "cd":
-		runCd(os.Args[2:])
+		runCd(ctx, os.Args[2:])
+	case "sparse":
+		runSparse(ctx, os.Args[2:])
 	case "-h", "--help", "help":
 		fmt.Print(usage)
 	case "-v", "--version", "version":
@@ -69,87 +174,306 @@ func main() {
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		fmt.Print(usage)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
-func runNew(args []string) {
+// parseArgs parses flags that may appear before or after positional
+// arguments (e.g. `wt new hotfix -b main`) and returns the positionals
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args) // ExitOnError handles errors
+		if fs.NArg() == 0 {
+			return positional
+		}
+		// Everything after "--" is positional
+		if n := len(args) - fs.NArg(); n > 0 && args[n-1] == "--" {
+			return append(positional, fs.Args()...)
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// fail prints err and exits with the code matching its kind
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+// exitCode maps an error to one of the documented exit codes
+func exitCode(err error) int {
+	var cmdErr *git.CommandError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, cmd.ErrNameRequired), errors.Is(err, session.ErrInvalidName):
+		return exitUsage
+	case errors.Is(err, session.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, session.ErrAmbiguous):
+		return exitAmbiguous
+	case errors.Is(err, session.ErrAlreadyExists):
+		return exitAlreadyExists
+	case errors.Is(err, git.ErrNotARepo):
+		return exitNotARepo
+	case errors.Is(err, git.ErrDirtyWorktree), errors.Is(err, session.ErrUnpushedSubmodule):
+		return exitDirty
+	case errors.Is(err, session.ErrLocked):
+		return exitLocked
+	case errors.As(err, &cmdErr):
+		return exitGitFailed
+	default:
+		return exitError
+	}
+}
+
+// sessionArg returns the session named in args, or lets the user pick one
+// for command if there is none
+func sessionArg(ctx context.Context, app *cmd.App, command string, args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	name, err := app.PickSession(ctx, command)
+	if err != nil {
+		fail(err)
+	}
+	return name
+}
+
+// newApp builds the command dependencies, exiting if that fails
+func newApp(ctx context.Context) *cmd.App {
+	app, err := cmd.NewApp(ctx)
+	if err != nil {
+		fail(err)
+	}
+	return app
+}
+
+func runNew(ctx context.Context, args []string) {
 	fs := flag.NewFlagSet("new", flag.ExitOnError)
 	branch := fs.String("b", "", "Source branch to create worktree from")
 	fs.StringVar(branch, "branch", "", "Source branch to create worktree from")
-	_ = fs.Parse(args) // ExitOnError handles errors
+	base := fs.String("base", "", "Branch from the source's remote-tracking ref (remote) or local branch (local)")
+	noFetch := fs.Bool("no-fetch", false, "Don't fetch the source branch from its remote")
+	fs.BoolVar(noFetch, "offline", false, "Don't fetch the source branch from its remote")
+	fetch := fs.Bool("fetch", false, "Fetch even if disabled in config or fetched recently")
+	count := fs.Int("n", 1, "Create this many sessions from the same commit")
+	fs.IntVar(count, "count", 1, "Create this many sessions from the same commit")
+	prompt := fs.String("p", "", "Initial instruction for the agent")
+	fs.StringVar(prompt, "prompt", "", "Initial instruction for the agent")
+	promptFile := fs.String("prompt-file", "", "Read the initial instruction from a file (- for stdin)")
+	bg := fs.Bool("bg", false, "Run the agent headless in the background")
+	slugify := fs.Bool("slugify", false, "Turn the name into a valid session name")
+	var tags stringList
+	fs.Var(&tags, "t", "Label the session; repeat for several")
+	fs.Var(&tags, "tag", "Label the session; repeat for several")
+	var sparse stringList
+	fs.Var(&sparse, "sparse", "Check out only this directory; repeat or use commas for several")
+	noSparse := fs.Bool("no-sparse", false, "Check out everything even if wt.sparse is set")
+	submodules := fs.Bool("submodules", false, "Check out submodules")
+	noSubmodules := fs.Bool("no-submodules", false, "Leave submodules uninitialized")
+	lfs := fs.String("lfs", "", "How to get Git LFS files: smudge, skip or share")
+	noWarm := fs.Bool("no-warm", false, "Don't clone the warm directories")
+	positional := parseArgs(fs, args)
+
+	if *count < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --count must be at least 1")
+		os.Exit(exitUsage)
+	}
 
 	opts := cmd.NewOptions{
 		SourceBranch: *branch,
+		Base:         *base,
+		NoFetch:      *noFetch,
+		Fetch:        *fetch,
+		Count:        *count,
+		Prompt:       *prompt,
+		PromptFile:   *promptFile,
+		Background:   *bg,
+		Tags:         tags,
+		Slugify:      *slugify,
+		NoSparse:     *noSparse,
+		Submodules:   *submodules,
+		NoSubmodules: *noSubmodules,
+		LFS:          *lfs,
+		NoWarm:       *noWarm,
+	}
+	for _, value := range sparse {
+		for dir := range strings.SplitSeq(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				opts.Sparse = append(opts.Sparse, dir)
+			}
+		}
 	}
 
 	// First non-flag argument is the session name
-	if fs.NArg() > 0 {
-		opts.Name = fs.Arg(0)
+	if len(positional) > 0 {
+		opts.Name = positional[0]
 	}
 
-	if err := cmd.RunNew(opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if err := newApp(ctx).RunNew(ctx, opts); err != nil {
+		fail(err)
 	}
 }
 
-func runFg(args []string) {
+func runFg(ctx context.Context, args []string) {
+	app := newApp(ctx)
+	name := sessionArg(ctx, app, "fg", args)
+	if err := app.RunFg(ctx, name); err != nil {
+		fail(err)
+	}
+}
+
+func runShow(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	positional := parseArgs(fs, args)
+
+	if len(positional) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: session name required")
+		fmt.Fprintln(os.Stderr, "Usage: wt show <session-name> [--json]")
+		os.Exit(exitUsage)
+	}
+
+	if err := newApp(ctx).RunShow(ctx, positional[0], *asJSON); err != nil {
+		fail(err)
+	}
+}
+
+func runAttach(ctx context.Context, args []string) {
 	if len(args) < 1 {
 		fmt.Fprintln(os.Stderr, "Error: session name required")
-		fmt.Fprintln(os.Stderr, "Usage: wt fg <session-name>")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Usage: wt attach <session-name>")
+		os.Exit(exitUsage)
+	}
+
+	if err := newApp(ctx).RunAttach(ctx, args[0]); err != nil {
+		fail(err)
+	}
+}
+
+func runRun(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	prompt := fs.String("p", "", "New instruction for the agent")
+	fs.StringVar(prompt, "prompt", "", "New instruction for the agent")
+	promptFile := fs.String("prompt-file", "", "Read the instruction from a file (- for stdin)")
+	positional := parseArgs(fs, args)
+
+	if len(positional) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: session name required")
+		fmt.Fprintln(os.Stderr, "Usage: wt run <session-name> [-p prompt | --prompt-file file]")
+		os.Exit(exitUsage)
+	}
+
+	opts := cmd.RunOptions{
+		SessionName: positional[0],
+		Prompt:      *prompt,
+		PromptFile:  *promptFile,
+	}
+	if err := newApp(ctx).RunRun(ctx, opts); err != nil {
+		fail(err)
+	}
+}
+
+func runLogs(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	follow := fs.Bool("f", false, "Keep printing output until the agent finishes")
+	fs.BoolVar(follow, "follow", false, "Keep printing output until the agent finishes")
+	positional := parseArgs(fs, args)
+
+	if len(positional) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: session name required")
+		fmt.Fprintln(os.Stderr, "Usage: wt logs <session-name> [-f]")
+		os.Exit(exitUsage)
+	}
+
+	if err := newApp(ctx).RunLogs(ctx, positional[0], *follow); err != nil {
+		fail(err)
 	}
+}
 
-	if err := cmd.RunFg(args[0]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+func runLs(ctx context.Context) {
+	if err := newApp(ctx).RunLs(ctx); err != nil {
+		fail(err)
 	}
 }
 
-func runLs() {
-	if err := cmd.RunLs(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+func runUI(ctx context.Context) {
+	if err := newApp(ctx).RunUI(ctx); err != nil {
+		fail(err)
 	}
 }
 
-func runRm(args []string) {
+func runRm(ctx context.Context, args []string) {
 	fs := flag.NewFlagSet("rm", flag.ExitOnError)
 	all := fs.Bool("a", false, "Remove all sessions")
 	fs.BoolVar(all, "all", false, "Remove all sessions")
-	_ = fs.Parse(args) // ExitOnError handles errors
+	force := fs.Bool("f", false, "Remove even with unpushed submodule commits or a running agent")
+	fs.BoolVar(force, "force", false, "Remove even with unpushed submodule commits or a running agent")
+	positional := parseArgs(fs, args)
 
 	opts := cmd.RmOptions{
-		All: *all,
+		All:   *all,
+		Force: *force,
 	}
 
-	if fs.NArg() > 0 {
-		opts.SessionName = fs.Arg(0)
+	app := newApp(ctx)
+	if !opts.All {
+		opts.SessionName = sessionArg(ctx, app, "rm", positional)
 	}
 
-	if !opts.All && opts.SessionName == "" {
-		fmt.Fprintln(os.Stderr, "Error: session name required (or use --all)")
-		fmt.Fprintln(os.Stderr, "Usage: wt rm <session-name>")
-		fmt.Fprintln(os.Stderr, "       wt rm -a|--all")
-		os.Exit(1)
+	if err := app.RunRm(ctx, opts); err != nil {
+		fail(err)
 	}
+}
 
-	if err := cmd.RunRm(opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+func runCd(ctx context.Context, args []string) {
+	app := newApp(ctx)
+	name := sessionArg(ctx, app, "cd", args)
+	if err := app.RunCd(ctx, name); err != nil {
+		fail(err)
 	}
 }
 
-func runCd(args []string) {
+func runSparse(ctx context.Context, args []string) {
+	const sparseUsage = "Usage: wt sparse add <session-name> <dir>...\n       wt sparse list [session-name]"
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Error: session name required")
-		fmt.Fprintln(os.Stderr, "Usage: wt cd <session-name>")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error: subcommand required")
+		fmt.Fprintln(os.Stderr, sparseUsage)
+		os.Exit(exitUsage)
 	}
 
-	if err := cmd.RunCd(args[0]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: session name and at least one directory required")
+			fmt.Fprintln(os.Stderr, sparseUsage)
+			os.Exit(exitUsage)
+		}
+		if err := newApp(ctx).RunSparseAdd(ctx, args[1], args[2:]); err != nil {
+			fail(err)
+		}
+	case "list":
+		app := newApp(ctx)
+		name := sessionArg(ctx, app, "sparse list", args[1:])
+		if err := app.RunSparseList(ctx, name); err != nil {
+			fail(err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown subcommand: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, sparseUsage)
+		os.Exit(exitUsage)
 	}
 }